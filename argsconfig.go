@@ -0,0 +1,39 @@
+package boa
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// WithArgsFromConfig defaults omitted positional args from config, so that
+// e.g. `mycli deploy` can deploy to a configured default target while
+// `mycli deploy prod` overrides it. keys[i] is the config key of the default
+// for the i-th positional arg. Missing args are filled in order and filling
+// stops at the first key that isn't set in cfg.
+//
+// The filled args are what the command's args validator and run function
+// see, so a validator such as cobra.ExactArgs(1) passes when the arg comes
+// from config. Both are wrapped when the command is built, so they may be set
+// before or after this is called. Pre-run and post-run functions are given
+// the args as they were passed.
+func (b *CobraCmdBuilder) WithArgsFromConfig(cfg *viper.Viper, keys ...string) *CobraCmdBuilder {
+	fill := func(args []string) []string {
+		for i := len(args); i < len(keys) && cfg.IsSet(keys[i]); i++ {
+			args = append(args, cfg.GetString(keys[i]))
+		}
+		return args
+	}
+	b.onBuild = append(b.onBuild, func() {
+		if validate := b.cmd.Args; validate != nil {
+			b.cmd.Args = func(cmd *cobra.Command, args []string) error {
+				return validate(cmd, fill(args))
+			}
+		}
+		wrapRun(b.cmd, func(next runFunc) runFunc {
+			return func(cmd *cobra.Command, args []string) error {
+				return next(cmd, fill(args))
+			}
+		})
+	})
+	return b
+}
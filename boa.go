@@ -1,19 +1,44 @@
 package boa
 
 import (
-	"os"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
 	"text/tabwriter"
 
 	"github.com/spf13/cobra"
 )
 
+const (
+	// columnPadding is the widest padding used between tabwriter columns when
+	// rendering help and usage text.
+	columnPadding = 8
+	// defaultWidth is the width help text is wrapped to when the output isn't
+	// a terminal.
+	defaultWidth = 80
+	// HelpFormatFlagName is the name of the flag registered by
+	// WithHelpAnchors to choose the help format.
+	HelpFormatFlagName = "help-format"
+)
+
 type (
 	// Option is used to define multiple positional args in which the positional
-	// args can have a description. Aliases for the args can be added to the Args
-	// slice.
+	// args can have a description. An option is given by its Name or any of its
+	// Aliases. An optional Example is shown beneath the description. Persistent
+	// options are also shown in the help of any subcommands.
 	Option struct {
-		Args []string
-		Desc string
+		Name    string
+		Aliases []string
+		// Args are the names of the option, each of which may hold several
+		// comma separated names, e.g. "option1, opt1". They're only used if
+		// Name isn't set.
+		//
+		// Deprecated: Use Name and Aliases instead.
+		Args       []string
+		Desc       string
+		Example    string
+		Persistent bool
 	}
 
 	// Profile is used to bundle multiple options as a single option
@@ -28,23 +53,64 @@ type (
 		*cobra.Command
 		Opts     []Option
 		Profiles []Profile
+		Steps    []*Command
+		argsTmpl string
+		columnar bool
+		wrapping bool
+		width    int
+		theme    *ColorTheme
+		colorize bool
 	}
 )
 
+// persistentOptionsAnnotation is the annotation of a cobra Command that holds
+// the persistent options of the boa Command wrapping it, encoded as JSON, so
+// that subcommands can find the persistent options of their ancestors.
+const persistentOptionsAnnotation = "boa_persistent_options"
+
 // Build returns a boa Command from a BoaCmdBuilder
 func (b Command) ToBuilder() *BoaCmdBuilder {
+	b.annotatePersistentOptions()
 	return &BoaCmdBuilder{
 		NewCobraCmd(b.Use),
 		&b,
 	}
 }
 
+// annotatePersistentOptions records the persistent options of the boa Command
+// on its cobra Command.
+func (c Command) annotatePersistentOptions() {
+	if c.Command == nil {
+		return
+	}
+	var opts []Option
+	for _, opt := range c.Opts {
+		if opt.Persistent {
+			opts = append(opts, opt)
+		}
+	}
+	if len(opts) == 0 {
+		delete(c.Annotations, persistentOptionsAnnotation)
+		return
+	}
+	data, err := json.Marshal(opts)
+	if err != nil {
+		return
+	}
+	if c.Annotations == nil {
+		c.Annotations = map[string]string{}
+	}
+	c.Annotations[persistentOptionsAnnotation] = string(data)
+}
+
 // UsageFunc overrides the default UsageFunc used by boa to facilitate showing
-// a custom usage template
+// a custom usage template. Like cobra's, usage is written to the command's
+// output, or stderr if it isn't set.
 func (c Command) UsageFunc(template string) func(*cobra.Command) error {
 	return func(cmd *cobra.Command) error {
-		w := tabwriter.NewWriter(os.Stdout, 8, 8, 8, ' ', 0)
-		err := tmpl(w, template, c)
+		out := cmd.OutOrStderr()
+		w := tabwriter.NewWriter(out, 8, 8, 8, ' ', 0)
+		err := tmpl(w, template, c.rendering(out))
 		if err != nil {
 			cmd.PrintErrln(err)
 		}
@@ -53,59 +119,143 @@ func (c Command) UsageFunc(template string) func(*cobra.Command) error {
 }
 
 // HelpFunc overrides the default HelpFunc used by cobra to facilitate showing
-// a custom help template
+// a custom help template. Help is written to the command's output, or stdout
+// if it isn't set.
 func (c Command) HelpFunc(template string) func(*cobra.Command, []string) {
 	return func(cmd *cobra.Command, s []string) {
-		w := tabwriter.NewWriter(os.Stdout, 3, 3, 3, ' ', 0)
-		err := tmpl(w, template, c)
+		out := cmd.OutOrStdout()
+		w := tabwriter.NewWriter(out, 3, 3, 3, ' ', 0)
+		err := tmpl(w, template, c.rendering(out))
 		if err != nil {
 			cmd.PrintErrln(err)
 		}
 	}
 }
 
+// rendering returns a copy of c set up to render text to out, so that the
+// functions rendering c can be called concurrently.
+func (c Command) rendering(out io.Writer) Command {
+	var tty bool
+	c.width, tty = terminalWidth(out)
+	c.colorize = c.useColor(tty)
+	return c
+}
+
 // OptionsTemplate is used to override the cobra UsageTemplate to facilitate
 // options and other CLI parameters
 func (c Command) OptionsTemplate() string {
-	return `Usage:{{if .Runnable}}
-  {{.UseLine}}{{end}}{{if .HasOptions}} [options]{{end}}{{if .HasAvailableSubCommands}}
+	return `{{.Anchor "usage"}}{{$.Heading "Usage:"}}{{if .Runnable}}
+  {{.UseLine}}{{end}}{{if .HasOptions}} {{.UsageArgs}}{{end}}{{if .HasAvailableSubCommands}}
   {{.CommandPath}} [command]{{end}}{{if gt (len .Aliases) 0}}
 
-Aliases:
+{{$.Heading "Aliases:"}}
   {{.NameAndAliases}}{{end}}{{if .HasExample}}
 
-Examples:
+{{$.Heading "Examples:"}}
 {{.Example}}{{end}}{{if .HasAvailableSubCommands}}{{$cmds := .Commands}}{{if eq (len .Groups) 0}}
 
-Available Commands:{{range $cmds}}{{if (or .IsAvailableCommand (eq .Name "help"))}}
+{{$.Heading "Available Commands:"}}{{range $cmds}}{{if (or .IsAvailableCommand (eq .Name "help"))}}
   {{rpad .Name .NamePadding }} {{.Short}}{{end}}{{end}}{{else}}{{range $group := .Groups}}
 
-{{.Title}}{{range $cmds}}{{if (and (eq .GroupID $group.ID) (or .IsAvailableCommand (eq .Name "help")))}}
+{{$.Heading .Title}}{{range $cmds}}{{if (and (eq .GroupID $group.ID) (or .IsAvailableCommand (eq .Name "help")))}}
   {{rpad .Name .NamePadding }} {{.Short}}{{end}}{{end}}{{end}}{{if not .AllChildCommandsHaveGroup}}
 
-Additional Commands:{{range $cmds}}{{if (and (eq .GroupID "") (or .IsAvailableCommand (eq .Name "help")))}}
+{{$.Heading "Additional Commands:"}}{{range $cmds}}{{if (and (eq .GroupID "") (or .IsAvailableCommand (eq .Name "help")))}}
   {{rpad .Name .NamePadding }} {{.Short}}{{end}}{{end}}{{end}}{{end}}{{end}}{{if .HasOptions}}
 
-Options:{{range .Opts }}
-  {{.Args | sliceToCsv}}	{{.Desc}}{{end}}{{end}}{{if .HasProfiles}}
+{{.Anchor "options"}}{{$.Heading "Options:"}}{{range $row := .OptionRows }}
+  {{range $i, $opt := $row}}{{if $i}}	{{end}}{{$.OptionName ($opt.Names | sliceToCsv)}}	{{$.OptionDesc $opt.Desc}}{{if and $opt.Example (eq (len $row) 1)}}
+  {{$.OptionName ""}}	{{$.Describe (print "e.g. " $opt.Example)}}{{end}}{{end}}{{end}}{{end}}{{if .HasInheritedOptions}}
 
-Profiles:{{range .Profiles }}
-  {{.Args | sliceToCsv}}	{{.Desc}}
-    ↳ Options:	{{.Opts | sliceToCsv}}{{end}}{{end}}{{if .HasAvailableLocalFlags}}
+{{.Anchor "global-options"}}{{$.Heading "Global Options:"}}{{range .InheritedOptions }}
+  {{$.OptionName (.Names | sliceToCsv)}}	{{$.OptionDesc .Desc}}{{end}}{{end}}{{if .HasProfiles}}
 
-Flags:
+{{.Anchor "profiles"}}{{$.Heading "Profiles:"}}{{range .Profiles }}
+  {{$.OptionName (.Args | sliceToCsv)}}	{{$.Describe .Desc}}
+    {{$.OptionName "↳ Options:"}}	{{.Opts | sliceToCsv}}{{end}}{{end}}{{if .HasSteps}}
+
+{{.Anchor "steps"}}{{$.Heading "Steps:"}}{{range .Steps }}
+  {{.Name}}	{{.Short}}{{end}}{{end}}{{if .HasAvailableLocalFlags}}
+
+{{.Anchor "flags"}}{{$.Heading "Flags:"}}
 {{.LocalFlags.FlagUsages | trimTrailingWhitespaces}}{{end}}{{if .HasAvailableInheritedFlags}}
 
-Global Flags:
+{{.Anchor "global-flags"}}{{$.Heading "Global Flags:"}}
 {{.InheritedFlags.FlagUsages | trimTrailingWhitespaces}}{{end}}{{if .HasHelpSubCommands}}
 
-Additional help topics:{{range .Commands}}{{if .IsAdditionalHelpTopicCommand}}
+{{$.Heading "Additional help topics:"}}{{range .Commands}}{{if .IsAdditionalHelpTopicCommand}}
   {{rpad .CommandPath .CommandPathPadding}} {{.Short}}{{end}}{{end}}{{end}}{{if .HasAvailableSubCommands}}
 
 Use "{{.CommandPath}} [command] --help" for more information about a command.{{end}}
 `
 }
 
+// Names returns the names the option can be given by, its Name followed by
+// its Aliases, or the names in its Args if Name isn't set.
+func (o Option) Names() []string {
+	if o.Name != "" {
+		return append([]string{o.Name}, o.Aliases...)
+	}
+	return splitNames(o.Args)
+}
+
+// Names returns the names the profile can be given by, which are the names
+// in its Args.
+func (p Profile) Names() []string {
+	return splitNames(p.Args)
+}
+
+// splitNames returns the names in args, each of which may hold several comma
+// separated names.
+func splitNames(args []string) []string {
+	var names []string
+	for _, arg := range args {
+		for _, name := range strings.Split(arg, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// contains returns whether names holds name.
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// UsageArgs returns the options placeholder shown in the usage line, which is
+// "[options]" unless an args template was set with WithArgsTemplate; this is
+// primarily used for templating purposes.
+func (c Command) UsageArgs() string {
+	if c.argsTmpl == "" {
+		return "[options]"
+	}
+	var b strings.Builder
+	if err := tmpl(&b, c.argsTmpl, c); err != nil {
+		return "[options]"
+	}
+	return b.String()
+}
+
+// ArgsSummary returns the first arg of each option joined by pipes within
+// braces, e.g. {option1|option2}; this is primarily used for templating
+// purposes.
+func (c Command) ArgsSummary() string {
+	args := make([]string, 0, len(c.Opts))
+	for _, opt := range c.Opts {
+		if names := opt.Names(); len(names) > 0 {
+			args = append(args, names[0])
+		}
+	}
+	return "{" + strings.Join(args, "|") + "}"
+}
+
 // HasOptions returns whether the boa Command has any options defined; this is
 // primary used for templating purposes.
 func (c Command) HasOptions() bool {
@@ -123,3 +273,140 @@ func (c Command) HasProfiles() bool {
 	}
 	return true
 }
+
+// ResolveProfile returns the options referenced by the profile given by name,
+// which may be any of the profile's names, so that a run function can act on
+// each option of the selected profile. Options are looked up among the boa
+// Command's own options and those it inherits. An error is returned if there's
+// no such profile or it references an option that doesn't exist.
+func (c Command) ResolveProfile(name string) ([]Option, error) {
+	for _, prof := range c.Profiles {
+		if !contains(prof.Names(), name) {
+			continue
+		}
+		opts := make([]Option, 0, len(prof.Opts))
+		for _, optName := range prof.Opts {
+			opt, ok := c.lookupOption(optName)
+			if !ok {
+				return nil, fmt.Errorf("profile %q references unknown option %q", name, optName)
+			}
+			opts = append(opts, opt)
+		}
+		return opts, nil
+	}
+	return nil, fmt.Errorf("unknown profile %q", name)
+}
+
+// lookupOption returns the option of the boa Command, or one it inherits,
+// given by name.
+func (c Command) lookupOption(name string) (Option, bool) {
+	for _, opts := range [][]Option{c.Opts, c.InheritedOptions()} {
+		for _, opt := range opts {
+			if contains(opt.Names(), name) {
+				return opt, true
+			}
+		}
+	}
+	return Option{}, false
+}
+
+// InheritedOptions returns the persistent options of the boa Command's
+// ancestors, nearest first; this is primarily used for templating purposes.
+func (c Command) InheritedOptions() []Option {
+	var opts []Option
+	for p := c.Parent(); p != nil; p = p.Parent() {
+		var persistent []Option
+		if err := json.Unmarshal([]byte(p.Annotations[persistentOptionsAnnotation]), &persistent); err == nil {
+			opts = append(opts, persistent...)
+		}
+	}
+	return opts
+}
+
+// HasInheritedOptions returns whether any of the boa Command's ancestors have
+// persistent options; this is primarily used for templating purposes.
+func (c Command) HasInheritedOptions() bool {
+	return len(c.InheritedOptions()) > 0
+}
+
+// HasSteps returns whether the boa Command is a chain of steps; this is
+// primarily used for templating purposes.
+func (c Command) HasSteps() bool {
+	return len(c.Steps) > 0
+}
+
+// OptionRows returns the boa Command's options grouped by the row they should
+// be rendered on; this is primarily used for templating purposes. Each option
+// gets its own row unless columnar options are enabled and the terminal is
+// wide enough to fit them in two columns, in which case the options fill the
+// left column before the right.
+func (c Command) OptionRows() [][]Option {
+	cols := 1
+	if c.columnar && c.width >= c.columnarWidth() {
+		cols = 2
+	}
+	rows := make([][]Option, (len(c.Opts)+cols-1)/cols)
+	for i, opt := range c.Opts {
+		rows[i%len(rows)] = append(rows[i%len(rows)], opt)
+	}
+	return rows
+}
+
+// Anchor returns an HTML comment marking the start of the help section with
+// the given name, e.g. "<!-- anchor: app-sub-options -->", when help anchors
+// are requested with --help-format=anchored, and nothing otherwise; this is
+// primarily used for templating purposes. Anchor IDs are made of the command
+// path and section name so that they are stable and unique across commands.
+func (c Command) Anchor(section string) string {
+	f := c.Flag(HelpFormatFlagName)
+	if f == nil || f.Value.String() != "anchored" {
+		return ""
+	}
+	id := strings.ReplaceAll(c.CommandPath(), " ", "-") + "-" + section
+	return "<!-- anchor: " + id + " -->\n"
+}
+
+// WrapWidth returns the width help text should be wrapped to, or 0 if help
+// wrapping isn't enabled; this is primarily used for templating purposes,
+// e.g. {{wrap .WrapWidth .Long}}.
+func (c Command) WrapWidth() int {
+	if !c.wrapping {
+		return 0
+	}
+	if c.width <= 0 {
+		return defaultWidth
+	}
+	return c.width
+}
+
+// OptionDesc returns the description of an option, wrapped to fit beside the
+// option args when help wrapping is enabled; this is primarily used for
+// templating purposes. Options rendered in two columns aren't wrapped.
+func (c Command) OptionDesc(desc string) string {
+	if c.WrapWidth() == 0 || len(c.OptionRows()) < len(c.Opts) {
+		return c.Describe(desc)
+	}
+	args := 0
+	for _, opt := range c.Opts {
+		if l := len(sliceToCsv(opt.Names())); l > args {
+			args = l
+		}
+	}
+	width := c.WrapWidth() - 2 - args - columnPadding
+	return strings.ReplaceAll(c.Describe(wrap(width, desc)), "\n", "\n  "+c.OptionName("")+"\t")
+}
+
+// columnarWidth returns the terminal width needed to render the options in
+// two columns without any line wrapping.
+func (c Command) columnarWidth() int {
+	args, desc := 0, 0
+	for _, opt := range c.Opts {
+		if l := len(sliceToCsv(opt.Names())); l > args {
+			args = l
+		}
+		if l := len(opt.Desc); l > desc {
+			desc = l
+		}
+	}
+	return 2 + 2*(args+desc) + 3*columnPadding
+}
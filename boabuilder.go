@@ -1,6 +1,9 @@
 package boa
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/spf13/cobra"
 )
 
@@ -15,8 +18,8 @@ type BoaCmdBuilder struct {
 // ToBoaCmdBuilder is used to convert a cobra.Command to a BoaCmdBuilder.
 func ToBoaCmdBuilder(cmd *cobra.Command) *BoaCmdBuilder {
 	return &BoaCmdBuilder{
-		&CobraCmdBuilder{cmd},
-		&Command{cmd, []Option{}, []Profile{}},
+		&CobraCmdBuilder{cmd: cmd},
+		&Command{Command: cmd, Opts: []Option{}, Profiles: []Profile{}},
 	}
 }
 
@@ -36,44 +39,74 @@ func NewCmd(use string) *BoaCmdBuilder {
 // WithOptions is used to add any number of options to the boa Command
 func (b *BoaCmdBuilder) WithOptions(opts ...Option) *BoaCmdBuilder {
 	b.cmd.Opts = append(b.cmd.Opts, opts...)
+	b.cmd.annotatePersistentOptions()
 	return b
 }
 
 // WithValidOptions is used to add any number of options to the boa Command and
-// set them as ValidArgs
+// set their names and aliases as ValidArgs
 func (b *BoaCmdBuilder) WithValidOptions(opts ...Option) *BoaCmdBuilder {
 	b.cmd.Opts = append(b.cmd.Opts, opts...)
-	for _, opt := range b.cmd.Opts {
-		b.cmd.ValidArgs = append(b.cmd.ValidArgs, opt.Args...)
+	for _, opt := range opts {
+		b.cmd.ValidArgs = append(b.cmd.ValidArgs, opt.Names()...)
 	}
+	b.cmd.annotatePersistentOptions()
 	return b
 }
 
-// WithProfiles is used to add any number of options to the boa Command
+// WithProfiles is used to add any number of profiles to the boa Command. When
+// the command is built, any options the profiles reference that the command
+// doesn't have are reported by Err.
 func (b *BoaCmdBuilder) WithProfiles(profs ...Profile) *BoaCmdBuilder {
 	b.cmd.Profiles = append(b.cmd.Profiles, profs...)
+	b.checkProfiles(profs)
 	return b
 }
 
-// WithValidProfiles is used to add any number of options to the boa Command and
-// set them as ValidArgs
+// WithValidProfiles is used to add any number of profiles to the boa Command
+// and set them as ValidArgs. As with WithProfiles, references to options the
+// command doesn't have are reported by Err.
 func (b *BoaCmdBuilder) WithValidProfiles(profs ...Profile) *BoaCmdBuilder {
 	b.cmd.Profiles = append(b.cmd.Profiles, profs...)
+	b.checkProfiles(profs)
 	for _, prof := range b.cmd.Profiles {
 		b.cmd.ValidArgs = append(b.cmd.ValidArgs, prof.Args...)
 	}
 	return b
 }
 
+// checkProfiles records an error for each of profs that references options
+// the boa Command doesn't have once it's built, so that options may be added
+// before or after the profiles that use them.
+func (b *BoaCmdBuilder) checkProfiles(profs []Profile) {
+	b.onBuild = append(b.onBuild, func() {
+		for _, prof := range profs {
+			var missing []string
+			for _, name := range prof.Opts {
+				if _, ok := b.cmd.lookupOption(name); !ok {
+					missing = append(missing, name)
+				}
+			}
+			if len(missing) > 0 {
+				b.errs = append(b.errs, fmt.Errorf("profile %q references unknown options %v", sliceToCsv(prof.Names()), missing))
+			}
+		}
+	})
+}
+
 // WithUsageTemplate is used to add a custom template for usage text
 func (b *BoaCmdBuilder) WithUsageTemplate(template string) *BoaCmdBuilder {
-	b.WithUsageFunc(b.cmd.UsageFunc(template))
+	b.WithUsageFunc(func(cmd *cobra.Command) error {
+		return b.cmd.UsageFunc(template)(cmd)
+	})
 	return b
 }
 
 // WithHelpTemplate is used to add a custom template for help text
 func (b *BoaCmdBuilder) WithHelpTemplate(template string) *BoaCmdBuilder {
-	b.WithHelpFunc(b.cmd.HelpFunc(template))
+	b.WithHelpFunc(func(cmd *cobra.Command, args []string) {
+		b.cmd.HelpFunc(template)(cmd, args)
+	})
 	return b
 }
 
@@ -83,6 +116,71 @@ func (b *BoaCmdBuilder) WithOptionsTemplate() *BoaCmdBuilder {
 	return b.WithUsageTemplate(template).WithHelpTemplate(template)
 }
 
+// WithColorOptionsTemplate is like WithOptionsTemplate, but colors the
+// headings, options and descriptions of the usage and help text with theme.
+// Colors are only used when the output is a terminal and NO_COLOR isn't set.
+func (b *BoaCmdBuilder) WithColorOptionsTemplate(theme ColorTheme) *BoaCmdBuilder {
+	b.cmd.theme = &theme
+	return b.WithOptionsTemplate()
+}
+
+// WithColumnarOptions is used to render the options in two columns when the
+// terminal is wide enough to fit them. Narrow terminals and non-TTY output
+// fall back to a single column.
+func (b *BoaCmdBuilder) WithColumnarOptions() *BoaCmdBuilder {
+	b.cmd.columnar = true
+	return b
+}
+
+// WithArgsTemplate is used to customize how the options are rendered in the
+// usage line in place of "[options]". The template is executed with the boa
+// Command, so {{.ArgsSummary}} renders the options as {option1|option2}.
+func (b *BoaCmdBuilder) WithArgsTemplate(template string) *BoaCmdBuilder {
+	b.cmd.argsTmpl = template
+	return b
+}
+
+// WithHelpWrapping is used to wrap long option descriptions in the usage and
+// help text to the width of the terminal, or 80 columns when the output isn't
+// a terminal. Custom templates can wrap other text, such as the command's long
+// description, with {{wrap .WrapWidth .Long}}.
+func (b *BoaCmdBuilder) WithHelpWrapping() *BoaCmdBuilder {
+	b.cmd.wrapping = true
+	return b
+}
+
+// WithHelpAnchors is used to let the usage and help text be scraped into
+// docs that deep-link to its sections. It registers a persistent
+// --help-format flag that, when set to "anchored", marks the start of each
+// section with an HTML comment holding a stable anchor ID. The default
+// "text" format is unchanged.
+func (b *BoaCmdBuilder) WithHelpAnchors() *BoaCmdBuilder {
+	b.cmd.PersistentFlags().String(HelpFormatFlagName, "text", "help output format, text or anchored")
+	return b
+}
+
+// WithContext sets the context the command is executed with, so that its
+// run functions can observe cancellation and deadlines through
+// cmd.Context(). Executing the command with ExecuteContext replaces it.
+func (b *BoaCmdBuilder) WithContext(ctx context.Context) *BoaCmdBuilder {
+	b.cmd.SetContext(ctx)
+	return b
+}
+
+// WithContextValue is used to add a value to the command's context before it
+// runs, so that dependencies such as loggers or clients can be retrieved from
+// cmd.Context() rather than globals. Multiple calls layer their values.
+//
+// The value is added in a persistent pre-run function, so subcommands see it
+// too unless they define a persistent pre-run function of their own.
+func (b *BoaCmdBuilder) WithContextValue(key any, value any) *BoaCmdBuilder {
+	b.beforePersistentPreRun(func(cmd *cobra.Command, args []string) error {
+		cmd.SetContext(context.WithValue(cmd.Context(), key, value))
+		return nil
+	})
+	return b
+}
+
 // WithMinValidArgs will cause the command to throw an error if at least minArgs
 // valid arguments are not provided
 func (b *BoaCmdBuilder) WithMinValidArgs(minArgs int) *BoaCmdBuilder {
@@ -111,10 +209,24 @@ func (b *BoaCmdBuilder) ToCobraCmdBuilder() *CobraCmdBuilder {
 //
 // This method allows bypassing the ToCobraCmdBuilder() step before Build()
 func (b *BoaCmdBuilder) BuildCobraCmd() *cobra.Command {
-	return b.cmd.Command
+	return b.Build().Command
 }
 
-// Build returns a boa Command from a BoaCmdBuilder
+// Build returns a boa Command from a BoaCmdBuilder. Like the Build method of
+// CobraCmdBuilder, it's the must variant of BuildE and panics with the errors
+// encountered while building the command.
 func (b *BoaCmdBuilder) Build() *Command {
-	return b.cmd
+	cmd, err := b.BuildE()
+	if err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
+// BuildE returns a boa Command from a BoaCmdBuilder along with the errors
+// encountered while building it, such as profiles that reference unknown
+// options, joined together as by Err.
+func (b *BoaCmdBuilder) BuildE() (*Command, error) {
+	b.runOnBuild()
+	return b.cmd, b.Err()
 }
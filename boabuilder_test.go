@@ -1,9 +1,17 @@
 package boa
 
 import (
-	"io/ioutil"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
@@ -74,17 +82,592 @@ Flags:
 
 	assert.Equal(t, expectedOptionsOutput, captureCmdOutput(cmd1, "-h"))
 	assert.Equal(t, expectedProfilesOutput, captureCmdOutput(cmd2, "-h"))
+
+	cmd, err := NewCmd("profiles").
+		WithOptions(options...).
+		WithProfiles(profiles...).
+		WithProfiles(Profile{Args: []string{"broken"}, Opts: []string{"option3"}}).
+		BuildE()
+	assert.EqualError(t, err, `profile "broken" references unknown options [option3]`)
+	opts, err := cmd.ResolveProfile("prof1")
+	assert.NoError(t, err)
+	assert.Equal(t, options, opts)
+	opts, err = cmd.ResolveProfile("profile2")
+	assert.NoError(t, err)
+	assert.Equal(t, options[:1], opts)
+	_, err = cmd.ResolveProfile("profile3")
+	assert.EqualError(t, err, `unknown profile "profile3"`)
+	_, err = cmd.ResolveProfile("broken")
+	assert.EqualError(t, err, `profile "broken" references unknown option "option3"`)
 }
 
 func captureCmdOutput(cmd *cobra.Command, args ...string) string {
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetArgs(args)
+	cmd.Execute()
+	return out.String()
+}
+
+func TestBoaCmdBuilderColumnarOptions(t *testing.T) {
+	options := []Option{
+		{Args: []string{"option1"}, Desc: "first"},
+		{Args: []string{"option2"}, Desc: "second"},
+		{Args: []string{"option3"}, Desc: "third"},
+	}
+	newCmd := func() *cobra.Command {
+		return NewCmd("columns").
+			WithOptions(options...).
+			WithColumnarOptions().
+			WithOptionsTemplate().
+			WithNoOp().
+			Build()
+	}
+	defer func(f func(io.Writer) (int, bool)) { terminalWidth = f }(terminalWidth)
+
+	terminalWidth = func(io.Writer) (int, bool) { return 120, true }
+	expectedWide := `Usage:
+  columns [flags] [options]
+
+Options:
+  option1   first   option3   third
+  option2   second
+
+Flags:
+  -h, --help   help for columns
+`
+	assert.Equal(t, expectedWide, captureCmdOutput(newCmd(), "-h"))
+
+	terminalWidth = func(io.Writer) (int, bool) { return 0, false }
+	expectedNarrow := `Usage:
+  columns [flags] [options]
+
+Options:
+  option1   first
+  option2   second
+  option3   third
+
+Flags:
+  -h, --help   help for columns
+`
+	assert.Equal(t, expectedNarrow, captureCmdOutput(newCmd(), "-h"))
+}
+
+func TestBoaCmdBuilderWithContextValue(t *testing.T) {
+	type ctxKey string
+	var got []any
+	run := func(cmd *cobra.Command, args []string) {
+		got = append(got, cmd.Context().Value(ctxKey("logger")), cmd.Context().Value(ctxKey("db")))
+	}
+	child := NewCobraCmd("child").WithRunFunc(run).Build()
+	cmd := NewCmd("root").
+		WithContextValue(ctxKey("logger"), "logger").
+		WithContextValue(ctxKey("db"), "db").
+		WithSubCommands(child).
+		WithRunFunc(run).
+		Build()
+
+	cmd.SetArgs([]string{})
+	assert.NoError(t, cmd.Execute())
+	cmd.SetArgs([]string{"child"})
+	assert.NoError(t, cmd.Execute())
+	assert.Equal(t, []any{"logger", "db", "logger", "db"}, got)
+}
+
+func TestBoaCmdBuilderHelpWrapping(t *testing.T) {
+	defer func(f func(io.Writer) (int, bool)) { terminalWidth = f }(terminalWidth)
+	terminalWidth = func(io.Writer) (int, bool) { return 40, true }
+	cmd := NewCmd("wrap").
+		WithOptions(Option{Args: []string{"option"}, Desc: "a long description that will not fit on one line"}).
+		WithHelpWrapping().
+		WithOptionsTemplate().
+		WithNoOp().
+		Build()
+	expected := `Usage:
+  wrap [flags] [options]
+
+Options:
+  option   a long description that
+           will not fit on one line
+
+Flags:
+  -h, --help   help for wrap
+`
+	assert.Equal(t, expected, captureCmdOutput(cmd, "-h"))
+	assert.Equal(t, "first line\n\nsecond\nline", wrap(10, "first line\n\nsecond line"))
+}
+
+func TestBoaCmdBuilderWithConfirmation(t *testing.T) {
+	defer func(f func(io.Reader) bool) { isTerminal = f }(isTerminal)
+	tests := []struct {
+		name     string
+		terminal bool
+		input    string
+		args     []string
+		err      error
+	}{
+		{name: "yes", terminal: true, input: "y\n"},
+		{name: "no", terminal: true, input: "n\n", err: ErrNotConfirmed},
+		{name: "empty", terminal: true, input: "\n", err: ErrNotConfirmed},
+		{name: "flag", args: []string{"--yes"}},
+		{name: "no terminal", err: ErrConfirmationRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isTerminal = func(io.Reader) bool { return tt.terminal }
+			ran := false
+			cmd := NewCmd("delete").
+				WithConfirmation("").
+				WithRunFunc(func(*cobra.Command, []string) { ran = true }).
+				SilenceErrors().
+				SilenceUsage().
+				Build()
+			out := new(bytes.Buffer)
+			cmd.SetIn(strings.NewReader(tt.input))
+			cmd.SetOut(out)
+			cmd.SetArgs(tt.args)
+
+			err := cmd.Execute()
+			assert.ErrorIs(t, err, tt.err)
+			assert.Equal(t, tt.err == nil, ran)
+			if tt.terminal {
+				assert.Equal(t, "Are you sure? (y/N) ", out.String())
+			}
+		})
+	}
+}
+
+func TestExecuteWith(t *testing.T) {
+	cmd := NewCmd("panics").
+		WithRunFunc(func(*cobra.Command, []string) { panic("boom") }).
+		ToBoaCmdBuilder().
+		Build()
+	cmd.SetArgs([]string{})
+
+	err := ExecuteWith(cmd, func(run func() error) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("recovered: %v", r)
+			}
+		}()
+		return run()
+	})
+	assert.EqualError(t, err, "recovered: boom")
+}
+
+func TestBoaCmdBuilderHelpAnchors(t *testing.T) {
+	newCmd := func() *cobra.Command {
+		return NewCmd("anchors").
+			WithOptions(Option{Args: []string{"option"}, Desc: "an option"}).
+			WithProfiles(Profile{Args: []string{"profile"}, Opts: []string{"option"}, Desc: "a profile"}).
+			WithHelpAnchors().
+			WithOptionsTemplate().
+			WithNoOp().
+			Build()
+	}
+	expected := `<!-- anchor: anchors-usage -->
+Usage:
+  anchors [flags] [options]
+
+<!-- anchor: anchors-options -->
+Options:
+  option   an option
+
+<!-- anchor: anchors-profiles -->
+Profiles:
+  profile        a profile
+    ↳ Options:   option
+
+<!-- anchor: anchors-flags -->
+Flags:
+  -h, --help                 help for anchors
+      --help-format string   help output format, text or anchored (default "text")
+`
+	assert.Equal(t, expected, captureCmdOutput(newCmd(), "-h", "--help-format", "anchored"))
+	assert.NotContains(t, captureCmdOutput(newCmd(), "-h"), "<!--")
+}
+
+func TestCommandPrintTree(t *testing.T) {
+	cmd := NewCmd("app").
+		WithShortDescription("an app").
+		WithSubCommands(
+			NewCobraCmd("config").
+				WithShortDescription("manage config").
+				WithSubCommands(
+					NewCobraCmd("get").WithShortDescription("get a value").WithNoOp().Build(),
+					NewCobraCmd("set").WithShortDescription("set a value").WithNoOp().Build(),
+				).
+				Build(),
+			NewCobraCmd("hidden").WithNoOp().Hidden().Build(),
+			NewCobraCmd("version").WithShortDescription("print the version").WithNoOp().Build(),
+		).
+		ToBoaCmdBuilder().
+		Build()
+
+	expected := `app         an app
+  config    manage config
+    get     get a value
+    set     set a value
+  version   print the version
+`
+	buf := new(bytes.Buffer)
+	assert.NoError(t, cmd.PrintTree(buf))
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestBoaCmdBuilderOptionExamples(t *testing.T) {
+	cmd := NewCmd("deploy").
+		WithOptions(
+			Option{Args: []string{"option1"}, Desc: "first option", Example: "option1=foo"},
+			Option{Args: []string{"option2"}, Desc: "second option"},
+		).
+		WithOptionsTemplate().
+		WithNoOp().
+		Build()
+	expected := `Usage:
+  deploy [flags] [options]
+
+Options:
+  option1   first option
+            e.g. option1=foo
+  option2   second option
+
+Flags:
+  -h, --help   help for deploy
+`
+	assert.Equal(t, expected, captureCmdOutput(cmd, "-h"))
+}
+
+func TestBoaCmdBuilderWithChain(t *testing.T) {
+	type ctxKey string
+	var ran []string
+	step := func(name string, err error) *Command {
+		return NewCmd(name).
+			WithShortDescription(name + " the app").
+			WithRunEFunc(func(cmd *cobra.Command, args []string) error {
+				ran = append(ran, fmt.Sprint(name, args, cmd.Context().Value(ctxKey("run"))))
+				return err
+			}).
+			ToBoaCmdBuilder().
+			Build()
+	}
+	newCmd := func(steps ...*Command) *cobra.Command {
+		cmd := NewCmd("release").
+			WithChain(steps...).
+			WithOptionsTemplate().
+			SilenceErrors().
+			SilenceUsage().
+			Build()
+		cmd.SetContext(context.WithValue(context.Background(), ctxKey("run"), 1))
+		return cmd
+	}
+
+	cmd := newCmd(step("build", nil), step("test", nil), step("deploy", nil))
+	cmd.SetArgs([]string{"v1"})
+	assert.NoError(t, cmd.Execute())
+	assert.Equal(t, []string{"build[v1] 1", "test[v1] 1", "deploy[v1] 1"}, ran)
+
+	ran = nil
+	cmd = newCmd(step("build", nil), step("test", errors.New("tests failed")), step("deploy", nil))
+	cmd.SetArgs([]string{})
+	assert.EqualError(t, cmd.Execute(), "tests failed")
+	assert.Equal(t, []string{"build[] 1", "test[] 1"}, ran)
+
+	expected := `Usage:
+  release [flags]
+
+Steps:
+  build    build the app
+  test     test the app
+  deploy   deploy the app
+
+Flags:
+  -h, --help   help for release
+`
+	assert.Equal(t, expected, captureCmdOutput(newCmd(step("build", nil), step("test", nil), step("deploy", nil)), "-h"))
+}
+
+func TestBoaCmdBuilderInheritedOptions(t *testing.T) {
+	child := NewCmd("child").
+		WithOptions(Option{Args: []string{"local"}, Desc: "a child option"}).
+		WithOptionsTemplate().
+		Build()
+	child.Run = func(cmd *cobra.Command, args []string) {}
+	NewCmd("parent").
+		WithOptions(
+			Option{Args: []string{"global"}, Desc: "an inherited option", Persistent: true},
+			Option{Args: []string{"parent-only"}, Desc: "not inherited"},
+		).
+		WithSubCommands(child.Command).
+		Build()
+
+	expected := `Usage:
+  parent child [flags] [options]
+
+Options:
+  local   a child option
+
+Global Options:
+  global   an inherited option
+
+Flags:
+  -h, --help   help for child
+`
+	assert.Equal(t, expected, captureCmdOutput(child.Root(), "child", "-h"))
+
+	parent := Command{
+		Command: NewCobraCmd("parent").Build(),
+		Opts:    []Option{{Name: "global", Desc: "an inherited option", Persistent: true}},
+	}.ToBuilder().Build()
+	parent.AddCommand(child.Command)
+	assert.Equal(t, expected, captureCmdOutput(parent.Command, "child", "-h"))
+}
+
+func TestBoaCmdBuilderArgsTemplate(t *testing.T) {
+	cmd := NewCmd("deploy").
+		WithOptions(
+			Option{Args: []string{"staging", "stg"}, Desc: "deploy to staging"},
+			Option{Args: []string{"production"}, Desc: "deploy to production"},
+		).
+		WithArgsTemplate("{{.ArgsSummary}}").
+		WithOptionsTemplate().
+		Build()
+	cmd.Run = func(cmd *cobra.Command, args []string) {}
+
+	assert.Contains(t, captureCmdOutput(cmd.Command, "-h"), "deploy [flags] {staging|production}\n")
+}
+
+func TestBoaCmdBuilderWithOptionValidator(t *testing.T) {
+	regions := map[string]bool{"us-east-1": true, "eu-west-1": true}
+	cmd := NewCmd("deploy").
+		WithOptions(Option{Args: []string{"region", "r"}, Desc: "the region to deploy to"}).
+		WithOptionValidator("region", func(value string) error {
+			if !regions[value] {
+				return errors.New("unknown region")
+			}
+			return nil
+		}).
+		Build()
+	cmd.Run = func(cmd *cobra.Command, args []string) {}
+	cmd.SilenceErrors, cmd.SilenceUsage = true, true
+
+	cmd.SetArgs([]string{"region=us-east-1"})
+	assert.NoError(t, cmd.Execute())
+	cmd.SetArgs([]string{"r=mars-1"})
+	assert.EqualError(t, cmd.Execute(), `invalid value "mars-1" for option "region": unknown region`)
+
+	cmd = NewCmd("deploy").
+		WithValidOptions(Option{Args: []string{"region", "r"}, Desc: "the region to deploy to"}).
+		WithMinValidArgs(1).
+		WithOptionValidator("region", func(value string) error {
+			if !regions[value] {
+				return errors.New("unknown region")
+			}
+			return nil
+		}).
+		Build()
+	var got []string
+	cmd.Run = func(cmd *cobra.Command, args []string) { got = args }
+	cmd.SilenceErrors, cmd.SilenceUsage = true, true
+
+	cmd.SetArgs([]string{"r=eu-west-1"})
+	assert.NoError(t, cmd.Execute())
+	assert.Equal(t, []string{"r=eu-west-1"}, got)
+	cmd.SetArgs([]string{"region=mars-1"})
+	assert.EqualError(t, cmd.Execute(), `invalid value "mars-1" for option "region": unknown region`)
+	cmd.SetArgs([]string{"zone=a"})
+	assert.EqualError(t, cmd.Execute(), `invalid argument "zone=a" for "deploy"`)
+}
+
+func TestBoaCmdBuilderWithExactlyOneOption(t *testing.T) {
+	cmd := NewCmd("deploy").
+		WithOptions(
+			Option{Args: []string{"dev", "d"}, Desc: "deploy to dev"},
+			Option{Args: []string{"prod", "p"}, Desc: "deploy to prod"},
+			Option{Args: []string{"dry-run"}, Desc: "don't deploy"},
+		).
+		WithExactlyOneOption("dev", "prod").
+		Build()
+	cmd.Run = func(cmd *cobra.Command, args []string) {}
+	cmd.SilenceErrors, cmd.SilenceUsage = true, true
+
+	cmd.SetArgs([]string{"dry-run"})
+	assert.EqualError(t, cmd.Execute(), "exactly one of the options [dev prod] is required")
+	cmd.SetArgs([]string{"p", "dry-run"})
+	assert.NoError(t, cmd.Execute())
+	cmd.SetArgs([]string{"d", "prod"})
+	assert.EqualError(t, cmd.Execute(), "exactly one of the options [dev prod] is required, got [dev prod]")
+}
+
+func TestBoaCmdBuilderWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var err error
+	cmd := NewCmd("wait").
+		WithContext(ctx).
+		WithRunEFunc(func(cmd *cobra.Command, args []string) error {
+			cancel()
+			<-cmd.Context().Done()
+			err = cmd.Context().Err()
+			return nil
+		}).
+		Build()
+	cmd.SetArgs([]string{})
+	assert.NoError(t, cmd.Execute())
+	assert.ErrorIs(t, err, context.Canceled)
+
+	boaCmd := NewCmd("signal").
+		WithRunEFunc(func(cmd *cobra.Command, args []string) error {
+			p, _ := os.FindProcess(os.Getpid())
+			assert.NoError(t, p.Signal(syscall.SIGTERM))
+			select {
+			case <-cmd.Context().Done():
+				err = cmd.Context().Err()
+			case <-time.After(5 * time.Second):
+				err = errors.New("context wasn't cancelled")
+			}
+			return nil
+		}).
+		ToBoaCmdBuilder().
+		Build()
+	boaCmd.SetArgs([]string{})
+	assert.NoError(t, boaCmd.ExecuteWithSignalHandler())
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestBoaCmdBuilderHelpWritesToCmdOutput(t *testing.T) {
 	rescueStdout := os.Stdout
 	r, w, _ := os.Pipe()
 	os.Stdout = w
-	cmd.SetArgs(args)
-	cmd.Execute()
+	defer func() { os.Stdout = rescueStdout }()
+
+	cmd := NewCmd("deploy").
+		WithOptions(Option{Args: []string{"staging"}, Desc: "deploy to staging"}).
+		WithOptionsTemplate().
+		WithNoOp().
+		Build()
+	help, usage := new(bytes.Buffer), new(bytes.Buffer)
+	cmd.SetOut(help)
+	cmd.SetArgs([]string{"-h"})
+	assert.NoError(t, cmd.Execute())
+	cmd.SetOut(usage)
+	assert.NoError(t, cmd.Usage())
+
 	w.Close()
-	out, _ := ioutil.ReadAll(r)
-	output := string(out)
-	os.Stdout = rescueStdout
-	return output
+	stdout, _ := io.ReadAll(r)
+	assert.Empty(t, string(stdout))
+	assert.Contains(t, help.String(), "Options:\n  staging   deploy to staging\n")
+	assert.Contains(t, usage.String(), "Options:\n  staging        deploy to staging\n")
+}
+
+func TestBoaCmdBuilderHelpConcurrently(t *testing.T) {
+	cmd, err := NewCmd("deploy").
+		WithOptions(Option{Args: []string{"staging"}, Desc: "deploy to staging"}).
+		WithHelpWrapping().
+		BuildE()
+	assert.NoError(t, err)
+	cmd.SetOut(io.Discard)
+	help := cmd.HelpFunc(cmd.OptionsTemplate())
+	usage := cmd.UsageFunc(cmd.OptionsTemplate())
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			help(cmd.Command, nil)
+			assert.NoError(t, usage(cmd.Command))
+		}()
+	}
+	wg.Wait()
+}
+
+func TestBoaCmdBuilderWithColorOptionsTemplate(t *testing.T) {
+	newCmd := func() *cobra.Command {
+		return NewCmd("colors").
+			WithOptions(
+				Option{Args: []string{"a"}, Desc: "first", Example: "colors a"},
+				Option{Args: []string{"long"}, Desc: "second"},
+			).
+			WithColorOptionsTemplate(ColorTheme{Heading: "1", Option: "36", Description: "2"}).
+			WithNoOp().
+			Build()
+	}
+	defer func(f func(io.Writer) (int, bool)) { terminalWidth = f }(terminalWidth)
+	t.Setenv("NO_COLOR", "")
+	os.Unsetenv("NO_COLOR")
+
+	terminalWidth = func(io.Writer) (int, bool) { return 80, true }
+	expected := "\x1b[1mUsage:\x1b[0m\n" +
+		"  colors [flags] [options]\n\n" +
+		"\x1b[1mOptions:\x1b[0m\n" +
+		"  \x1b[36ma\x1b[0m      \x1b[2mfirst\x1b[0m\n" +
+		"  \x1b[36m\x1b[0m       \x1b[2me.g. colors a\x1b[0m\n" +
+		"  \x1b[36mlong\x1b[0m   \x1b[2msecond\x1b[0m\n\n" +
+		"\x1b[1mFlags:\x1b[0m\n" +
+		"  -h, --help   help for colors\n"
+	assert.Equal(t, expected, captureCmdOutput(newCmd(), "-h"))
+
+	t.Setenv("NO_COLOR", "1")
+	assert.NotContains(t, captureCmdOutput(newCmd(), "-h"), "\x1b[")
+
+	os.Unsetenv("NO_COLOR")
+	terminalWidth = func(io.Writer) (int, bool) { return 0, false }
+	assert.Equal(t, `Usage:
+  colors [flags] [options]
+
+Options:
+  a      first
+         e.g. colors a
+  long   second
+
+Flags:
+  -h, --help   help for colors
+`, captureCmdOutput(newCmd(), "-h"))
+}
+
+func TestBoaCmdBuilderOptionAliases(t *testing.T) {
+	complete := func(cmd *cobra.Command, toComplete string) string {
+		out := new(bytes.Buffer)
+		cmd.SetOut(out)
+		cmd.SetArgs([]string{cobra.ShellCompRequestCmd, toComplete})
+		assert.NoError(t, cmd.Execute())
+		return out.String()
+	}
+	expected := fmt.Sprintf("option1\nopt1\n:%d\n", cobra.ShellCompDirectiveNoFileComp)
+
+	cmd := NewCmd("aliases").
+		WithValidOptions(
+			Option{Name: "option1", Aliases: []string{"opt1"}, Desc: "first"},
+			Option{Name: "second", Desc: "second"},
+		).
+		WithOptionsTemplate().
+		WithNoOp().
+		Build()
+	assert.Equal(t, expected, complete(cmd, "opt"))
+	assert.Contains(t, captureCmdOutput(cmd, "-h"), "Options:\n  option1, opt1   first\n  second          second\n")
+
+	legacy := NewCmd("legacy").
+		WithValidOptions(Option{Args: []string{"option1, opt1"}, Desc: "first"}).
+		WithNoOp().
+		Build()
+	assert.Equal(t, expected, complete(legacy, "opt"))
+	assert.Equal(t, []string{"option1", "opt1"}, Option{Args: []string{"option1, opt1"}}.Names())
+}
+
+func TestBoaCmdBuilderProfileValidation(t *testing.T) {
+	b := NewCmd("install").
+		WithProfiles(Profile{Args: []string{"all"}, Opts: []string{"kubectl", "helm"}}).
+		WithOptions(Option{Name: "kubectl"}, Option{Name: "helm"})
+	_, err := b.BuildE()
+	assert.NoError(t, err)
+
+	b = NewCmd("install").
+		WithOptions(Option{Name: "kubectl"}).
+		WithValidProfiles(
+			Profile{Args: []string{"all, a"}, Opts: []string{"kubectl", "helm", "skaffold"}},
+			Profile{Args: []string{"minimal"}, Opts: []string{"kubectl"}},
+		)
+	cmd, err := b.BuildE()
+	assert.NotNil(t, cmd)
+	assert.EqualError(t, err, `profile "all, a" references unknown options [helm skaffold]`)
+	assert.PanicsWithError(t, err.Error(), func() { b.Build() })
 }
@@ -0,0 +1,44 @@
+package boa
+
+import "github.com/spf13/cobra"
+
+// WithChain is used to make the command a pipeline that runs each of the
+// steps in order, e.g. build then test then deploy, stopping at the first
+// step that returns an error. Each step's pre-run, run and post-run functions
+// are called with the chain's args and context, but its flags aren't parsed.
+// The steps are listed in the usage and help text.
+func (b *BoaCmdBuilder) WithChain(steps ...*Command) *BoaCmdBuilder {
+	b.cmd.Steps = append(b.cmd.Steps, steps...)
+	b.WithRunEFunc(func(cmd *cobra.Command, args []string) error {
+		for _, step := range b.cmd.Steps {
+			step.SetContext(cmd.Context())
+			if err := runStep(step.Command, args); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return b
+}
+
+// runStep calls the pre-run, run and post-run functions of cmd.
+func runStep(cmd *cobra.Command, args []string) error {
+	funcs := []struct {
+		runE runFunc
+		run  func(*cobra.Command, []string)
+	}{
+		{cmd.PreRunE, cmd.PreRun},
+		{cmd.RunE, cmd.Run},
+		{cmd.PostRunE, cmd.PostRun},
+	}
+	for _, f := range funcs {
+		if f.runE != nil {
+			if err := f.runE(cmd, args); err != nil {
+				return err
+			}
+		} else if f.run != nil {
+			f.run(cmd, args)
+		}
+	}
+	return nil
+}
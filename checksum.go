@@ -0,0 +1,50 @@
+package boa
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+)
+
+// ConfigChecksum returns a sha256 checksum of the effective configuration, so
+// that callers caching state derived from the config can tell when it has
+// changed between runs. The checksum only depends on the keys and values
+// set, not on the order in which they were set or where they came from.
+func (b *ViperCfgBuilder) ConfigChecksum() []byte {
+	h := sha256.New()
+	// JSON encodes maps with their keys sorted and values, such as times,
+	// the same way in every process, while keeping values of different
+	// types, such as 1 and "1", distinct.
+	if err := json.NewEncoder(h).Encode(jsonValue(b.cfg.AllSettings())); err != nil {
+		fmt.Fprintf(h, "%v", err)
+	}
+	return h.Sum(nil)
+}
+
+// jsonValue returns v with the maps keyed by values other than strings, which
+// some config formats decode, keyed by their string form so that v can be
+// encoded as JSON.
+func jsonValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[k] = jsonValue(e)
+		}
+		return m
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = jsonValue(e)
+		}
+		return m
+	case []any:
+		s := make([]any, len(v))
+		for i, e := range v {
+			s[i] = jsonValue(e)
+		}
+		return s
+	default:
+		return v
+	}
+}
@@ -1,7 +1,11 @@
 package boa
 
 import (
+	"errors"
+	"fmt"
 	"net"
+	"runtime/debug"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -12,13 +16,16 @@ import (
 // helpful methods. Flags can be added to a command using builder methods as
 // well.
 type CobraCmdBuilder struct {
-	cmd *cobra.Command
+	cmd               *cobra.Command
+	errs              []error
+	onBuild           []func()
+	requireSubcommand bool
 }
 
 // ToCobraCmdBuilder is used to convert an existing cobra.Command to a
 // CobraCmdBuilder.
 func ToCobraCmdBuilder(cmd *cobra.Command) *CobraCmdBuilder {
-	return &CobraCmdBuilder{cmd}
+	return &CobraCmdBuilder{cmd: cmd}
 }
 
 // NewCobraCmd creates a new CobraCmdBuilder and sets the use for the
@@ -98,6 +105,28 @@ func (b *CobraCmdBuilder) WithValidArgsFunction(validArgsFunc func(cmd *cobra.Co
 	return b
 }
 
+// WithFlagCompletionFunc sets a function that provides the values of the
+// named flag for shell completion. The flag must be defined first; if it
+// isn't, the error is reported by Err.
+func (b *CobraCmdBuilder) WithFlagCompletionFunc(name string, f func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective)) *CobraCmdBuilder {
+	if err := b.cmd.RegisterFlagCompletionFunc(name, f); err != nil {
+		b.errs = append(b.errs, err)
+	}
+	return b
+}
+
+// WithPositionalFileCompletion sets a ValidArgsFunction that completes
+// positional args as file names. If extensions are given, e.g. "yaml", "yml",
+// only files with those extensions are suggested.
+func (b *CobraCmdBuilder) WithPositionalFileCompletion(extensions ...string) *CobraCmdBuilder {
+	return b.WithValidArgsFunction(func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(extensions) == 0 {
+			return nil, cobra.ShellCompDirectiveDefault
+		}
+		return extensions, cobra.ShellCompDirectiveFilterFileExt
+	})
+}
+
 // WithArgs sets the expected arguments for the command.
 //
 // For example:
@@ -242,6 +271,42 @@ func (b *CobraCmdBuilder) WithRunEFunc(f func(cmd *cobra.Command, args []string)
 	return b
 }
 
+// The *Run functions are executed in the following order:
+//   - PersistentPreRun()
+//   - PreRun()
+//   - Run()
+//   - PostRun()
+//   - PersistentPostRun()
+//
+// All functions get the same args, the arguments after the command name.
+//
+// WithRunFuncSafe: Run but a panic is recovered and returned as a PanicError,
+// so that the CLI exits cleanly with a message rather than crashing.
+func (b *CobraCmdBuilder) WithRunFuncSafe(f func(cmd *cobra.Command, args []string)) *CobraCmdBuilder {
+	b.cmd.Run = nil
+	b.cmd.RunE = func(cmd *cobra.Command, args []string) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = PanicError{Value: r, Stack: debug.Stack()}
+			}
+		}()
+		f(cmd, args)
+		return nil
+	}
+	return b
+}
+
+// PanicError is returned by commands built with WithRunFuncSafe when their
+// run function panics.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e PanicError) Error() string {
+	return fmt.Sprintf("panic: %v\n\n%s", e.Value, e.Stack)
+}
+
 // The *Run functions are executed in the following order:
 //   - PersistentPreRun()
 //   - PreRun()
@@ -382,6 +447,40 @@ func (b *CobraCmdBuilder) WithSubCommands(cmds ...*cobra.Command) *CobraCmdBuild
 	return b
 }
 
+// WithAutoAlias gives each subcommand whose name is longer than minLen an
+// alias made of the first minLen characters of its name, e.g. "describe"
+// becomes "desc" with a minLen of 4. An alias is skipped if it matches the
+// name or alias of another subcommand, or if it would be generated for more
+// than one subcommand, so that no alias is ambiguous.
+//
+// Only subcommands added before calling WithAutoAlias are given aliases. A
+// minLen less than 1 is reported by Err.
+func (b *CobraCmdBuilder) WithAutoAlias(minLen int) *CobraCmdBuilder {
+	if minLen < 1 {
+		b.errs = append(b.errs, fmt.Errorf("auto alias length %d is less than 1", minLen))
+		return b
+	}
+	taken := map[string]int{}
+	for _, sub := range b.cmd.Commands() {
+		taken[sub.Name()]++
+		for _, alias := range sub.Aliases {
+			taken[alias]++
+		}
+		if len(sub.Name()) > minLen {
+			taken[sub.Name()[:minLen]]++
+		}
+	}
+	for _, sub := range b.cmd.Commands() {
+		if len(sub.Name()) <= minLen {
+			continue
+		}
+		if alias := sub.Name()[:minLen]; taken[alias] == 1 {
+			sub.Aliases = append(sub.Aliases, alias)
+		}
+	}
+	return b
+}
+
 // WithUsageTemplate sets usage template. Can be defined by Application.
 func (b *CobraCmdBuilder) WithUsageTemplate(template string) *CobraCmdBuilder {
 	b.cmd.SetUsageTemplate(template)
@@ -1471,9 +1570,8 @@ func (b *CobraCmdBuilder) WithVarPFlag(value pflag.Value, name string, shorthand
 // MarkFlagHidden sets a flag to 'hidden' in your program. It will continue to
 // function but will not show up in help or usage messages.
 func (b *CobraCmdBuilder) MarkFlagHidden(name string) *CobraCmdBuilder {
-	err := b.cmd.Flags().MarkHidden(name)
-	if err != nil {
-		panic(err)
+	if err := b.cmd.Flags().MarkHidden(name); err != nil {
+		b.errs = append(b.errs, err)
 	}
 	return b
 }
@@ -1482,9 +1580,8 @@ func (b *CobraCmdBuilder) MarkFlagHidden(name string) *CobraCmdBuilder {
 // will continue to function but will not show up in help or usage messages.
 // Using this flag will also print the given usageMessage.
 func (b *CobraCmdBuilder) MarkFlagDeprecated(name string, usage string) *CobraCmdBuilder {
-	err := b.cmd.Flags().MarkDeprecated(name, usage)
-	if err != nil {
-		panic(err)
+	if err := b.cmd.Flags().MarkDeprecated(name, usage); err != nil {
+		b.errs = append(b.errs, err)
 	}
 	return b
 }
@@ -1493,9 +1590,19 @@ func (b *CobraCmdBuilder) MarkFlagDeprecated(name string, usage string) *CobraCm
 // your program. It will continue to function but will not show up in help or
 // usage messages. Using this flag will also print the given usageMessage.
 func (b *CobraCmdBuilder) MarkFlagShorthandDeprecated(name string, usage string) *CobraCmdBuilder {
-	err := b.cmd.Flags().MarkShorthandDeprecated(name, usage)
-	if err != nil {
-		panic(err)
+	if err := b.cmd.Flags().MarkShorthandDeprecated(name, usage); err != nil {
+		b.errs = append(b.errs, err)
+	}
+	return b
+}
+
+// MarkFlagRequired instructs the various shell completion implementations to
+// prioritize the named flag when performing completion, and causes your
+// command to report an error if invoked without the flag. If the flag doesn't
+// exist, the error is reported by Err.
+func (b *CobraCmdBuilder) MarkFlagRequired(name string) *CobraCmdBuilder {
+	if err := b.cmd.MarkFlagRequired(name); err != nil {
+		b.errs = append(b.errs, fmt.Errorf("marking flag %q required: %w", name, err))
 	}
 	return b
 }
@@ -2567,9 +2674,8 @@ func (b *CobraCmdBuilder) WithVarPPersistentFlag(value pflag.Value, name string,
 // MarkFlagHidden sets a flag to 'hidden' in your program. It will continue to
 // function but will not show up in help or usage messages.
 func (b *CobraCmdBuilder) MarkPersistentFlagHidden(name string) *CobraCmdBuilder {
-	err := b.cmd.PersistentFlags().MarkHidden(name)
-	if err != nil {
-		panic(err)
+	if err := b.cmd.PersistentFlags().MarkHidden(name); err != nil {
+		b.errs = append(b.errs, err)
 	}
 	return b
 }
@@ -2578,9 +2684,8 @@ func (b *CobraCmdBuilder) MarkPersistentFlagHidden(name string) *CobraCmdBuilder
 // will continue to function but will not show up in help or usage messages.
 // Using this flag will also print the given usageMessage.
 func (b *CobraCmdBuilder) MarkPersistentFlagDeprecated(name string, usage string) *CobraCmdBuilder {
-	err := b.cmd.PersistentFlags().MarkDeprecated(name, usage)
-	if err != nil {
-		panic(err)
+	if err := b.cmd.PersistentFlags().MarkDeprecated(name, usage); err != nil {
+		b.errs = append(b.errs, err)
 	}
 	return b
 }
@@ -2589,9 +2694,103 @@ func (b *CobraCmdBuilder) MarkPersistentFlagDeprecated(name string, usage string
 // your program. It will continue to function but will not show up in help or
 // usage messages. Using this flag will also print the given usageMessage.
 func (b *CobraCmdBuilder) MarkPersistentFlagShorthandDeprecated(name string, usage string) *CobraCmdBuilder {
-	err := b.cmd.PersistentFlags().MarkShorthandDeprecated(name, usage)
-	if err != nil {
-		panic(err)
+	if err := b.cmd.PersistentFlags().MarkShorthandDeprecated(name, usage); err != nil {
+		b.errs = append(b.errs, err)
+	}
+	return b
+}
+
+// MarkFlagsMutuallyExclusive marks the given flags with annotations so that
+// Cobra errors if the command is invoked with more than one flag from the
+// given set of flags. The usage of each flag notes which flags it can't be
+// used with. The flags are marked when the command is built, so they may be
+// defined before or after this is called; if any of them don't exist by
+// then, the error is reported by Err and the flags aren't marked.
+func (b *CobraCmdBuilder) MarkFlagsMutuallyExclusive(names ...string) *CobraCmdBuilder {
+	b.onBuild = append(b.onBuild, func() {
+		if !b.hasFlags("mutually exclusive", names) {
+			return
+		}
+		b.cmd.MarkFlagsMutuallyExclusive(names...)
+		for _, name := range names {
+			var others []string
+			for _, other := range names {
+				if other != name {
+					others = append(others, "--"+other)
+				}
+			}
+			f := b.lookupFlag(name)
+			f.Usage += fmt.Sprintf(" (can't be used with %s)", strings.Join(others, ", "))
+		}
+	})
+	return b
+}
+
+// MarkFlagsRequiredTogether marks the given flags with annotations so that
+// Cobra errors if the command is invoked with a subset (but not all) of the
+// given flags. The flags are marked when the command is built, so they may
+// be defined before or after this is called; if any of them don't exist by
+// then, the error is reported by Err and the flags aren't marked.
+func (b *CobraCmdBuilder) MarkFlagsRequiredTogether(names ...string) *CobraCmdBuilder {
+	b.onBuild = append(b.onBuild, func() {
+		if b.hasFlags("required together", names) {
+			b.cmd.MarkFlagsRequiredTogether(names...)
+		}
+	})
+	return b
+}
+
+// MarkFlagsOneRequired marks the given flags so that the command errors if
+// it's invoked without at least one of them, such as when input may be given
+// by any of --file, --stdin or --url. The flags are marked when the command is
+// built, so they may be defined before or after this is called; if any of
+// them don't exist by then, the error is reported by Err.
+func (b *CobraCmdBuilder) MarkFlagsOneRequired(names ...string) *CobraCmdBuilder {
+	b.onBuild = append(b.onBuild, func() {
+		if !b.hasFlags("one required", names) {
+			return
+		}
+		b.beforePreRun(func(cmd *cobra.Command, args []string) error {
+			for _, name := range names {
+				if f := cmd.Flags().Lookup(name); f != nil && f.Changed {
+					return nil
+				}
+			}
+			return fmt.Errorf("at least one of the flags in the group %v is required", names)
+		})
+	})
+	return b
+}
+
+// lookupFlag returns the local or persistent flag of the command called name,
+// or nil if there isn't one.
+func (b *CobraCmdBuilder) lookupFlag(name string) *pflag.Flag {
+	if f := b.cmd.Flags().Lookup(name); f != nil {
+		return f
+	}
+	return b.cmd.PersistentFlags().Lookup(name)
+}
+
+// hasFlags returns whether the command has all of the named flags, reporting
+// those it doesn't have by Err as unable to be marked as the given group.
+func (b *CobraCmdBuilder) hasFlags(group string, names []string) bool {
+	ok := true
+	for _, name := range names {
+		if b.lookupFlag(name) == nil {
+			b.errs = append(b.errs, fmt.Errorf("marking flags %v %s: no such flag -%s", names, group, name))
+			ok = false
+		}
+	}
+	return ok
+}
+
+// MarkPersistentFlagRequired instructs the various shell completion
+// implementations to prioritize the named persistent flag when performing
+// completion, and causes your command to report an error if invoked without
+// the flag. If the flag doesn't exist, the error is reported by Err.
+func (b *CobraCmdBuilder) MarkPersistentFlagRequired(name string) *CobraCmdBuilder {
+	if err := b.cmd.MarkPersistentFlagRequired(name); err != nil {
+		b.errs = append(b.errs, fmt.Errorf("marking persistent flag %q required: %w", name, err))
 	}
 	return b
 }
@@ -2610,14 +2809,54 @@ func (b *CobraCmdBuilder) WithPersistentFlagSet(flagset *pflag.FlagSet) *CobraCm
 	return b
 }
 
+// WithFlagsFrom adds the local flags of another command to this command, or
+// its persistent flags to this command's persistent flags if persistent is
+// true, so common flags only need defining once. The flags are shared rather
+// than copied, so both commands set the same values. Flags whose name or
+// shorthand conflicts with a flag already on this command are skipped and
+// reported by Err.
+func (b *CobraCmdBuilder) WithFlagsFrom(other *cobra.Command, persistent bool) *CobraCmdBuilder {
+	src, dst := other.LocalNonPersistentFlags(), b.cmd.Flags()
+	if persistent {
+		src, dst = other.PersistentFlags(), b.cmd.PersistentFlags()
+	}
+	flags := pflag.NewFlagSet(other.Name(), pflag.ContinueOnError)
+	src.VisitAll(func(f *pflag.Flag) {
+		if b.hasFlag(f.Name, f.Shorthand) {
+			b.errs = append(b.errs, fmt.Errorf("flag %q from command %q conflicts with an existing flag", f.Name, other.Name()))
+			return
+		}
+		flags.AddFlag(f)
+	})
+	dst.AddFlagSet(flags)
+	return b
+}
+
+// hasFlag returns whether the command already has a local or persistent flag
+// with the given name or shorthand.
+func (b *CobraCmdBuilder) hasFlag(name string, shorthand string) bool {
+	for _, fs := range []*pflag.FlagSet{b.cmd.Flags(), b.cmd.PersistentFlags()} {
+		if fs.Lookup(name) != nil || (shorthand != "" && fs.ShorthandLookup(shorthand) != nil) {
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns the errors encountered while building the command, joined
+// together, or nil if there were none.
+func (b *CobraCmdBuilder) Err() error {
+	return errors.Join(b.errs...)
+}
+
 // ToBoaCmdBuilder returns a BoaCmdBuilder from a CobraCmdBuilder
 func (b *CobraCmdBuilder) ToBoaCmdBuilder() *BoaCmdBuilder {
 	return &BoaCmdBuilder{
 		b,
 		&Command{
-			b.cmd,
-			[]Option{},
-			[]Profile{},
+			Command:  b.cmd,
+			Opts:     []Option{},
+			Profiles: []Profile{},
 		},
 	}
 }
@@ -2625,13 +2864,34 @@ func (b *CobraCmdBuilder) ToBoaCmdBuilder() *BoaCmdBuilder {
 // BuildBoaCmd returns a boa Command from a CobraCmdBuilder
 func (b *CobraCmdBuilder) BuildBoaCmd() *Command {
 	return &Command{
-		b.cmd,
-		[]Option{},
-		[]Profile{},
+		Command:  b.cmd,
+		Opts:     []Option{},
+		Profiles: []Profile{},
 	}
 }
 
-// Build returns a cobra.Command from a CobraCmdBuilder
+// Build returns a cobra.Command from a CobraCmdBuilder. It's the must
+// variant of BuildE: it panics with the errors encountered while building the
+// command, such as marking a flag that doesn't exist as hidden.
 func (b *CobraCmdBuilder) Build() *cobra.Command {
-	return b.cmd
+	cmd, err := b.BuildE()
+	if err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
+// BuildE returns a cobra.Command from a CobraCmdBuilder along with the errors
+// encountered while building it, joined together as by Err.
+func (b *CobraCmdBuilder) BuildE() (*cobra.Command, error) {
+	b.runOnBuild()
+	return b.cmd, b.Err()
+}
+
+// runOnBuild runs the steps deferred until the command is built.
+func (b *CobraCmdBuilder) runOnBuild() {
+	for _, f := range b.onBuild {
+		f()
+	}
+	b.onBuild = nil
 }
@@ -1,14 +1,24 @@
 package boa
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
 	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -319,3 +329,882 @@ func TestCobraCmdBuilder(t *testing.T) {
 func getFuncName(function any) string {
 	return runtime.FuncForPC(reflect.ValueOf(function).Pointer()).Name()
 }
+
+func TestWithPositionalFileCompletion(t *testing.T) {
+	complete := func(cmd *cobra.Command) string {
+		out := new(bytes.Buffer)
+		cmd.SetOut(out)
+		cmd.SetArgs([]string{cobra.ShellCompRequestCmd, ""})
+		assert.NoError(t, cmd.Execute())
+		return out.String()
+	}
+
+	cmd := NewCobraCmd("files").WithPositionalFileCompletion().WithNoOp().Build()
+	assert.Equal(t, fmt.Sprintf(":%d\n", cobra.ShellCompDirectiveDefault), complete(cmd))
+
+	cmd = NewCobraCmd("yaml").WithPositionalFileCompletion("yaml", "yml").WithNoOp().Build()
+	assert.Equal(t, fmt.Sprintf("yaml\nyml\n:%d\n", cobra.ShellCompDirectiveFilterFileExt), complete(cmd))
+}
+
+func TestWithAutoAlias(t *testing.T) {
+	describe := NewCobraCmd("describe").WithNoOp().Build()
+	deploy := NewCobraCmd("deploy").WithNoOp().Build()
+	deployment := NewCobraCmd("deployment").WithNoOp().Build()
+	get := NewCobraCmd("get").WithNoOp().Build()
+	install := NewCobraCmd("install").WithNoOp().Build()
+	inst := NewCobraCmd("instance").WithAliases([]string{"inst"}).WithNoOp().Build()
+	NewCobraCmd("root").
+		WithSubCommands(describe, deploy, deployment, get, install, inst).
+		WithAutoAlias(4)
+
+	assert.Equal(t, []string{"desc"}, describe.Aliases)
+	// "depl" would be ambiguous between deploy and deployment
+	assert.Empty(t, deploy.Aliases)
+	assert.Empty(t, deployment.Aliases)
+	// get is too short to need an alias
+	assert.Empty(t, get.Aliases)
+	// "inst" is already an alias of instance
+	assert.Empty(t, install.Aliases)
+	assert.Equal(t, []string{"inst"}, inst.Aliases)
+
+	for _, minLen := range []int{0, -1} {
+		sub := NewCobraCmd("describe").WithNoOp().Build()
+		_, err := NewCobraCmd("root").WithSubCommands(sub).WithAutoAlias(minLen).BuildE()
+		assert.EqualError(t, err, fmt.Sprintf("auto alias length %d is less than 1", minLen))
+		assert.Empty(t, sub.Aliases)
+	}
+}
+
+func TestWithFlagsFrom(t *testing.T) {
+	common := NewCobraCmd("common").
+		WithStringPFlag("output", "o", "text", "output format").
+		WithBoolFlag("verbose", false, "verbose output").
+		WithStringPersistentFlag("namespace", "default", "namespace to use").
+		Build()
+
+	b := NewCobraCmd("get").
+		WithBoolPFlag("all", "a", false, "all resources").
+		WithStringPFlag("other", "o", "", "conflicting shorthand").
+		WithFlagsFrom(common, false).
+		WithFlagsFrom(common, true)
+	cmd, err := b.BuildE()
+
+	assert.NotNil(t, cmd.Flags().Lookup("verbose"))
+	assert.NotNil(t, cmd.Flags().Lookup("all"))
+	assert.Nil(t, cmd.Flags().Lookup("output"))
+	assert.NotNil(t, cmd.PersistentFlags().Lookup("namespace"))
+	assert.Nil(t, cmd.Flags().Lookup("namespace"))
+	assert.EqualError(t, err, `flag "output" from command "common" conflicts with an existing flag`)
+}
+
+func TestWithOutputPrefix(t *testing.T) {
+	build := NewCobraCmd("build").
+		WithOutputPrefix().
+		WithRunFunc(func(cmd *cobra.Command, args []string) {
+			cmd.Println("compiling")
+			cmd.Print("done\nno newline")
+		}).
+		Build()
+	root := NewCobraCmd("root").WithSubCommands(build).Build()
+	out := new(bytes.Buffer)
+	root.SetOut(out)
+	root.SetArgs([]string{"build"})
+
+	assert.NoError(t, root.Execute())
+	assert.Equal(t, "[build] compiling\n[build] done\n[build] no newline", out.String())
+}
+
+func TestWithPager(t *testing.T) {
+	defer func(f func(io.Writer) (int, bool), p func([]string, io.Reader, io.Writer) error) {
+		terminalWidth, runPager = f, p
+	}(terminalWidth, runPager)
+	t.Setenv("PAGER", "less -R")
+	var pager []string
+	var paged string
+	runPager = func(argv []string, r io.Reader, w io.Writer) error {
+		pager = argv
+		b, _ := io.ReadAll(r)
+		paged = string(b)
+		return nil
+	}
+	newCmd := func() (*cobra.Command, *bytes.Buffer) {
+		cmd := NewCobraCmd("app").WithLongDescription("long help").WithPager().Build()
+		out := new(bytes.Buffer)
+		cmd.SetOut(out)
+		cmd.SetArgs([]string{"--help"})
+		return cmd, out
+	}
+
+	terminalWidth = func(io.Writer) (int, bool) { return 80, true }
+	cmd, out := newCmd()
+	assert.NoError(t, cmd.Execute())
+	assert.Equal(t, []string{"less", "-R"}, pager)
+	assert.Contains(t, paged, "long help")
+	assert.Empty(t, out.String())
+
+	pager, paged = nil, ""
+	terminalWidth = func(io.Writer) (int, bool) { return 0, false }
+	cmd, out = newCmd()
+	assert.NoError(t, cmd.Execute())
+	assert.Nil(t, pager)
+	assert.Contains(t, out.String(), "long help")
+
+	terminalWidth = func(io.Writer) (int, bool) { return 80, true }
+	root := NewCobraCmd("root").Build()
+	sub := NewCobraCmd("sub").WithLongDescription("long help").WithPager().Build()
+	root.AddCommand(sub)
+	root.SetOut(new(bytes.Buffer))
+	root.SetArgs([]string{"sub", "--help"})
+	assert.NoError(t, root.Execute())
+	out = new(bytes.Buffer)
+	root.SetOut(out)
+	assert.Same(t, out, sub.OutOrStdout())
+
+	bin := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(bin, "less"), nil, 0o700))
+	t.Setenv("PATH", bin)
+	t.Setenv("PAGER", "")
+	assert.Equal(t, []string{filepath.Join(bin, "less"), "-R"}, pagerCommand())
+	t.Setenv("LESS", "FX")
+	assert.Equal(t, []string{filepath.Join(bin, "less")}, pagerCommand())
+}
+
+func TestWithArgsFromConfig(t *testing.T) {
+	cfg := viper.New()
+	cfg.Set("deploy.target", "staging")
+	var got []string
+	newCmd := func(args ...string) *cobra.Command {
+		cmd := NewCobraCmd("deploy").
+			WithArgsFromConfig(cfg, "deploy.target").
+			WithArgs(cobra.ExactArgs(1)).
+			WithRunFunc(func(cmd *cobra.Command, args []string) { got = args }).
+			SilenceErrors().
+			SilenceUsage().
+			Build()
+		cmd.SetArgs(args)
+		return cmd
+	}
+
+	assert.NoError(t, newCmd().Execute())
+	assert.Equal(t, []string{"staging"}, got)
+	assert.NoError(t, newCmd("prod").Execute())
+	assert.Equal(t, []string{"prod"}, got)
+
+	cfg.Set("deploy.target", nil)
+	assert.Error(t, newCmd().Execute())
+}
+
+func TestWithLazySubCommand(t *testing.T) {
+	calls := 0
+	var got []string
+	var verbose bool
+	factory := func() *cobra.Command {
+		calls++
+		return NewCobraCmd("lazy").
+			WithLongDescription("the real lazy command").
+			WithBoolFlag("force", false, "force it").
+			WithRunFunc(func(cmd *cobra.Command, args []string) {
+				force, _ := cmd.Flags().GetBool("force")
+				got = append(args, fmt.Sprint(force, verbose))
+			}).
+			Build()
+	}
+	newRoot := func() *cobra.Command {
+		return NewCobraCmd("root").
+			WithBoolVarPersistentFlag(&verbose, "verbose", false, "verbose output").
+			WithSubCommands(NewCobraCmd("other").WithNoOp().Build()).
+			WithLazySubCommand("lazy", "a lazy command", factory).
+			Build()
+	}
+
+	execute := func(root *cobra.Command, args ...string) error {
+		LoadLazySubCommands(root, args)
+		root.SetArgs(args)
+		return root.Execute()
+	}
+
+	root := newRoot()
+	assert.NoError(t, execute(root, "other"))
+	assert.Equal(t, 0, calls)
+
+	assert.NoError(t, execute(root, "--verbose", "lazy", "arg", "--force"))
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, []string{"arg", "true true"}, got)
+
+	assert.NoError(t, execute(root, "lazy", "again"))
+	assert.Equal(t, 1, calls)
+
+	root = newRoot()
+	out := new(bytes.Buffer)
+	root.SetOut(out)
+	assert.NoError(t, execute(root, "help", "lazy"))
+	assert.Equal(t, 2, calls)
+	assert.Contains(t, out.String(), "the real lazy command")
+
+	root = newRoot()
+	out.Reset()
+	root.SetOut(out)
+	assert.NoError(t, execute(root, cobra.ShellCompRequestCmd, "lazy", "--fo"))
+	assert.Equal(t, 3, calls)
+	assert.Contains(t, out.String(), "--force")
+
+	root = newRoot()
+	root.SetArgs([]string{"--verbose=false", "lazy", "direct", "--force"})
+	assert.NoError(t, root.Execute())
+	assert.Equal(t, 4, calls)
+	assert.Equal(t, []string{"direct", "true false"}, got)
+}
+
+func TestWithLazySubCommandExecute(t *testing.T) {
+	var hooks []string
+	record := func(hook string) func(*cobra.Command, []string) {
+		return func(cmd *cobra.Command, args []string) {
+			hooks = append(hooks, hook+" "+cmd.Name()+" "+strings.Join(args, ","))
+		}
+	}
+	root := NewCobraCmd("root").
+		WithPersistentPreRunFunc(record("persistent pre-run")).
+		WithLazySubCommand("lazy", "a lazy command", func() *cobra.Command {
+			return NewCobraCmd("lazy").
+				WithSubCommands(NewCobraCmd("sub").
+					WithStringFlag("name", "", "name").
+					WithRunEFunc(func(cmd *cobra.Command, args []string) error {
+						name, _ := cmd.Flags().GetString("name")
+						hooks = append(hooks, "run "+name)
+						return errors.New("failed")
+					}).
+					Build()).
+				Build()
+		}).
+		Build()
+	root.SilenceErrors, root.SilenceUsage = true, true
+	root.SetArgs([]string{"lazy", "sub", "--name", "x", "arg"})
+	assert.EqualError(t, root.Execute(), "failed")
+	assert.Equal(t, []string{"persistent pre-run sub arg", "run x"}, hooks)
+}
+
+func TestWithRunFuncSafe(t *testing.T) {
+	cmd := NewCobraCmd("panics").
+		WithRunFuncSafe(func(*cobra.Command, []string) { panic("boom") }).
+		SilenceUsage().
+		Build()
+	errOut := new(bytes.Buffer)
+	cmd.SetErr(errOut)
+	cmd.SetArgs([]string{})
+
+	err := cmd.Execute()
+	var panicErr PanicError
+	assert.ErrorAs(t, err, &panicErr)
+	assert.Equal(t, "boom", panicErr.Value)
+	assert.Contains(t, string(panicErr.Stack), "TestWithRunFuncSafe")
+	assert.Contains(t, errOut.String(), "Error: panic: boom")
+
+	cmd = NewCobraCmd("ok").WithRunFuncSafe(func(*cobra.Command, []string) {}).Build()
+	cmd.SetArgs([]string{})
+	assert.NoError(t, cmd.Execute())
+}
+
+func TestCobraCmdBuilderWithTraceFlag(t *testing.T) {
+	cfg := NewViperCfg().WithDefault("log.level", "info")
+	newCmd := func() *cobra.Command {
+		return NewCobraCmd("app").
+			WithBoolFlag("verbose", false, "verbose output").
+			WithStringFlag("token", "", "api token").
+			WithPreRunFunc(func(cmd *cobra.Command, args []string) {}).
+			WithRunFunc(func(cmd *cobra.Command, args []string) {}).
+			WithTraceFlag(cfg).
+			Build()
+	}
+
+	cmd := newCmd()
+	stderr := new(bytes.Buffer)
+	cmd.SetErr(stderr)
+	cmd.SetArgs([]string{"--trace", "--token", "s3cret", "--verbose"})
+	assert.NoError(t, cmd.Execute())
+	assert.Equal(t, `[trace] command app, args []
+[trace] flag --help=false (changed: false)
+[trace] flag --token=[redacted] (changed: true)
+[trace] flag --trace=true (changed: true)
+[trace] flag --verbose=true (changed: true)
+[trace] config key log.level from default
+[trace] PreRun start
+[trace] PreRun end
+[trace] Run start
+[trace] Run end
+`, stderr.String())
+
+	stderr.Reset()
+	cmd.SetArgs([]string{"--trace=false"})
+	assert.NoError(t, cmd.Execute())
+	assert.Empty(t, stderr.String())
+
+	cmd = newCmd()
+	stderr.Reset()
+	cmd.SetErr(stderr)
+	cmd.SetArgs([]string{"--verbose"})
+	assert.NoError(t, cmd.Execute())
+	assert.Empty(t, stderr.String())
+}
+
+func TestCobraCmdBuilderWithJSONLinesOutput(t *testing.T) {
+	type record struct {
+		Name string `json:"name"`
+		Note string `json:"note"`
+	}
+	cmd := NewCobraCmd("list").
+		WithRunEFunc(func(cmd *cobra.Command, args []string) error {
+			assert.True(t, IsJSONLinesOutput(cmd))
+			w := NewJSONLinesWriter(cmd.OutOrStdout())
+			for _, r := range []record{{"a", "line\nbreak"}, {"b", "<tag>"}, {"c", ""}} {
+				if err := w.Write(r); err != nil {
+					return err
+				}
+			}
+			return nil
+		}).
+		WithJSONLinesOutput().
+		Build()
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetArgs([]string{"-o", "jsonl"})
+	assert.NoError(t, cmd.Execute())
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	assert.Len(t, lines, 3)
+	for _, line := range lines {
+		var obj map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(line), &obj))
+	}
+	assert.Equal(t, `{"name":"b","note":"<tag>"}`, lines[1])
+
+	cmd.SetArgs([]string{"-o", "yaml"})
+	cmd.SilenceErrors, cmd.SilenceUsage = true, true
+	assert.EqualError(t, cmd.Execute(), `invalid output format "yaml", expected text or jsonl`)
+}
+
+func TestCobraCmdBuilderWithRemovedShorthand(t *testing.T) {
+	cmd := NewCobraCmd("app").
+		WithBoolFlag("verbose", false, "verbose output").
+		WithNoOp().
+		WithRemovedShorthand("v", "--verbose").
+		Build()
+	cmd.SilenceErrors, cmd.SilenceUsage = true, true
+
+	cmd.SetArgs([]string{"-v"})
+	assert.EqualError(t, cmd.Execute(), "shorthand flag -v has been removed, use --verbose instead")
+	cmd.SetArgs([]string{"-x"})
+	assert.EqualError(t, cmd.Execute(), `unknown shorthand flag: 'x' in -x`)
+}
+
+func TestCobraCmdBuilderWithInheritedRequiredFlags(t *testing.T) {
+	leaf := NewCobraCmd("leaf").WithNoOp().Build()
+	mid := NewCobraCmd("mid").WithSubCommands(leaf).Build()
+	root := NewCobraCmd("app").
+		WithStringPersistentFlag("token", "", "api token").
+		WithSubCommands(mid).
+		Build()
+	assert.NoError(t, root.MarkPersistentFlagRequired("token"))
+	ToCobraCmdBuilder(root).WithInheritedRequiredFlags()
+	root.SilenceErrors, root.SilenceUsage = true, true
+
+	root.SetArgs([]string{"mid", "leaf"})
+	assert.EqualError(t, root.Execute(), `required flag(s) "token" not set`)
+	root.SetArgs([]string{"mid", "leaf", "--token", "abc"})
+	assert.NoError(t, root.Execute())
+}
+
+func TestCobraCmdBuilderWithHelpExitCode(t *testing.T) {
+	out := new(bytes.Buffer)
+	execute := func(args ...string) error {
+		out.Reset()
+		cmd := NewCobraCmd("app").
+			WithShortDescription("an app").
+			WithArgs(cobra.ExactArgs(1)).
+			WithNoOp().
+			WithHelpExitCode(2).
+			Build()
+		cmd.SilenceErrors = true
+		cmd.SetOut(out)
+		cmd.SetArgs(args)
+		return cmd.Execute()
+	}
+
+	assert.Equal(t, 0, ExitCode(execute("--help")))
+	assert.Contains(t, out.String(), "an app")
+
+	err := execute()
+	assert.Equal(t, 2, ExitCode(err))
+	assert.EqualError(t, err, "accepts 1 arg(s), received 0")
+	assert.Contains(t, out.String(), "an app")
+
+	assert.Equal(t, 2, ExitCode(execute("a", "--unknown")))
+	assert.Contains(t, out.String(), "an app")
+
+	assert.Equal(t, 0, ExitCode(execute("a")))
+	assert.Equal(t, 1, ExitCode(errors.New("failed")))
+
+	newRoot := func(b *CobraCmdBuilder) *cobra.Command {
+		cmd := b.WithSubCommands(NewCobraCmd("deploy").WithNoOp().Build()).Build()
+		cmd.SilenceErrors = true
+		cmd.SetOut(out)
+		return cmd
+	}
+	root := newRoot(NewCobraCmd("app").WithHelpExitCode(2))
+	out.Reset()
+	root.SetArgs([]string{"deplyo"})
+	err = root.Execute()
+	assert.Equal(t, 2, ExitCode(err))
+	assert.EqualError(t, err, "unknown command \"deplyo\" for \"app\"\n\nDid you mean this?\n\tdeploy\n")
+	assert.Contains(t, out.String(), "Available Commands:")
+	root.SetArgs([]string{})
+	assert.NoError(t, root.Execute())
+
+	for _, b := range []*CobraCmdBuilder{
+		NewCobraCmd("app").WithHelpExitCode(2).WithHelpOnNoArgs(false),
+		NewCobraCmd("app").WithHelpOnNoArgs(false).WithHelpExitCode(2),
+	} {
+		root = newRoot(b)
+		root.SetArgs([]string{})
+		assert.EqualError(t, root.Execute(), `"app" requires a subcommand`)
+	}
+}
+
+func TestCobraCmdBuilderWithEnumFlag(t *testing.T) {
+	var output string
+	newCmd := func() *cobra.Command {
+		cmd := NewCobraCmd("app").
+			WithEnumVarPFlag(&output, "output", "o", []string{"json", "yaml", "table"}, "table", "output format").
+			WithNoOp().
+			Build()
+		cmd.SilenceErrors, cmd.SilenceUsage = true, true
+		return cmd
+	}
+
+	cmd := newCmd()
+	assert.Equal(t, "table", output)
+	cmd.SetArgs([]string{"-o", "yaml"})
+	assert.NoError(t, cmd.Execute())
+	assert.Equal(t, "yaml", output)
+
+	cmd = newCmd()
+	cmd.SetArgs([]string{"--output", "xml"})
+	assert.EqualError(t, cmd.Execute(), `invalid argument "xml" for "-o, --output" flag: must be one of json, yaml, table`)
+	assert.Contains(t, cmd.UsageString(), "-o, --output json|yaml|table")
+
+	cmd = newCmd()
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetArgs([]string{cobra.ShellCompNoDescRequestCmd, "--output", ""})
+	assert.NoError(t, cmd.Execute())
+	assert.Equal(t, "json\nyaml\ntable\n:4\n", out.String())
+}
+
+func TestCobraCmdBuilderWithAliasSuggestions(t *testing.T) {
+	remove := NewCobraCmd("remove").WithAliases([]string{"delete"}).WithNoOp().Build()
+	list := NewCobraCmd("list").WithNoOp().Build()
+	cmd := NewCobraCmd("app").WithSubCommands(remove, list).WithAliasSuggestions().Build()
+	cmd.SilenceErrors, cmd.SilenceUsage = true, true
+
+	cmd.SetArgs([]string{"delte"})
+	assert.EqualError(t, cmd.Execute(), "unknown command \"delte\" for \"app\"\n\nDid you mean this?\n\tremove\n")
+	cmd.SetArgs([]string{"lst"})
+	assert.EqualError(t, cmd.Execute(), "unknown command \"lst\" for \"app\"\n\nDid you mean this?\n\tlist\n")
+	cmd.SetArgs([]string{"zzzzzz"})
+	assert.EqualError(t, cmd.Execute(), `unknown command "zzzzzz" for "app"`)
+	cmd.SetArgs([]string{"delete"})
+	assert.NoError(t, cmd.Execute())
+}
+
+func TestCobraCmdBuilderWithTimeFlag(t *testing.T) {
+	var since, until time.Time
+	newCmd := func() *cobra.Command {
+		cmd := NewCobraCmd("app").
+			WithTimeVarFlag(&since, "since", time.RFC3339, time.Time{}, "start time").
+			WithTimeVarPPersistentFlag(&until, "until", "u", "2006-01-02", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), "end date").
+			WithNoOp().
+			Build()
+		cmd.SilenceErrors, cmd.SilenceUsage = true, true
+		return cmd
+	}
+
+	cmd := newCmd()
+	assert.Equal(t, "2024-01-01", cmd.PersistentFlags().Lookup("until").DefValue)
+	cmd.SetArgs([]string{"--since", "2024-03-01T10:30:00Z", "-u", "2024-03-31"})
+	assert.NoError(t, cmd.Execute())
+	assert.Equal(t, time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC), since)
+	assert.Equal(t, time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC), until)
+
+	cmd = newCmd()
+	cmd.SetArgs([]string{"--until", "31/03/2024"})
+	assert.EqualError(t, cmd.Execute(), `invalid argument "31/03/2024" for "-u, --until" flag: expected a time in the layout "2006-01-02"`)
+}
+
+func TestCobraCmdBuilderWithURLFlag(t *testing.T) {
+	var endpoint url.URL
+	def, _ := url.Parse("http://localhost:8080")
+	newCmd := func() *cobra.Command {
+		cmd := NewCobraCmd("app").
+			WithURLVarFlag(&endpoint, "endpoint", def, "api endpoint").
+			WithURLFlag("mirror", nil, "mirror").
+			WithNoOp().
+			Build()
+		cmd.SilenceErrors, cmd.SilenceUsage = true, true
+		return cmd
+	}
+
+	cmd := newCmd()
+	assert.Equal(t, "http://localhost:8080", endpoint.String())
+	cmd.SetArgs([]string{"--endpoint", "http://example.com/api", "--mirror", "ftp://mirror.example.com/pub"})
+	assert.NoError(t, cmd.Execute())
+	assert.Equal(t, "example.com", endpoint.Host)
+	mirror, err := GetURL(cmd.Flags(), "mirror")
+	assert.NoError(t, err)
+	assert.Equal(t, "ftp", mirror.Scheme)
+	assert.Equal(t, "/pub", mirror.Path)
+
+	cmd = newCmd()
+	cmd.SetArgs([]string{"--endpoint", "example.com"})
+	assert.EqualError(t, cmd.Execute(), `invalid argument "example.com" for "--endpoint" flag: expected a URL with a scheme and host, e.g. https://example.com`)
+
+	_, err = GetURL(cmd.Flags(), "help")
+	assert.Error(t, err)
+}
+
+func TestCobraCmdBuilderWithExistingFileFlag(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte("a: 1"), 0o600))
+	var config, input string
+	execute := func(args ...string) error {
+		cmd := NewCobraCmd("app").
+			WithExistingFileVarFlag(&config, "config", "", "config file").
+			WithExistingFileOrStdinVarFlag(&input, "input", "", "input file, or - for stdin").
+			WithNoOp().
+			Build()
+		cmd.SilenceErrors, cmd.SilenceUsage = true, true
+		cmd.SetArgs(args)
+		return cmd.Execute()
+	}
+
+	assert.NoError(t, execute("--config", file, "--input", "-"))
+	assert.Equal(t, file, config)
+	assert.Equal(t, "-", input)
+
+	assert.ErrorContains(t, execute("--config", filepath.Join(dir, "missing.yaml")), "no such file or directory")
+	assert.EqualError(t, execute("--config", dir), fmt.Sprintf(`invalid argument %q for "--config" flag: %s is a directory, expected a file`, dir, dir))
+	assert.ErrorContains(t, execute("--config", "-"), "stat -: no such file or directory")
+}
+
+func TestCobraCmdBuilderWithDirFlag(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file.txt")
+	assert.NoError(t, os.WriteFile(file, nil, 0o600))
+	var out, cache string
+	execute := func(args ...string) error {
+		cmd := NewCobraCmd("app").
+			WithDirVarFlag(&out, "out", "", "output dir").
+			WithCreateDirVarFlag(&cache, "cache", "", "cache dir").
+			WithNoOp().
+			Build()
+		cmd.SilenceErrors, cmd.SilenceUsage = true, true
+		cmd.SetOut(io.Discard)
+		cmd.SetErr(io.Discard)
+		cmd.SetArgs(args)
+		return cmd.Execute()
+	}
+
+	assert.NoError(t, execute("--out", dir))
+	assert.Equal(t, dir, out)
+	missing := filepath.Join(dir, "missing")
+	assert.EqualError(t, execute("--out", missing), fmt.Sprintf(`invalid argument %q for "--out" flag: %s does not exist`, missing, missing))
+	assert.EqualError(t, execute("--out", file), fmt.Sprintf(`invalid argument %q for "--out" flag: %s is a file, expected a directory`, file, file))
+
+	created := filepath.Join(dir, "cache", "app")
+	assert.NoError(t, execute("--cache", created))
+	assert.DirExists(t, created)
+	assert.Equal(t, created, cache)
+	assert.Error(t, execute("--cache", file))
+
+	completed := filepath.Join(dir, "completed")
+	assert.NoError(t, execute(cobra.ShellCompRequestCmd, "--cache", completed, ""))
+	assert.NoDirExists(t, completed)
+}
+
+func TestCobraCmdBuilderWithHelpOnNoArgs(t *testing.T) {
+	out := new(bytes.Buffer)
+	execute := func(enabled bool) error {
+		out.Reset()
+		cmd := NewCobraCmd("app").
+			WithShortDescription("an app").
+			WithSubCommands(NewCobraCmd("sub").WithNoOp().Build()).
+			WithHelpOnNoArgs(enabled).
+			Build()
+		cmd.SilenceErrors, cmd.SilenceUsage = true, true
+		cmd.SetOut(out)
+		cmd.SetArgs([]string{})
+		return cmd.Execute()
+	}
+
+	err := execute(true)
+	assert.Equal(t, 0, ExitCode(err))
+	assert.Contains(t, out.String(), "an app")
+
+	err = execute(false)
+	assert.Equal(t, 1, ExitCode(err))
+	assert.EqualError(t, err, `"app" requires a subcommand`)
+	assert.Empty(t, out.String())
+
+	ran := false
+	cmd := NewCobraCmd("app").
+		WithHelpOnNoArgs(false).
+		WithRunFunc(func(*cobra.Command, []string) { ran = true }).
+		Build()
+	cmd.SetArgs([]string{})
+	assert.NoError(t, cmd.Execute())
+	assert.True(t, ran)
+
+	cmd = NewCobraCmd("app").WithSubCommands(NewCobraCmd("sub").WithNoOp().Build()).WithHelpOnNoArgs(true).Build()
+	assert.False(t, cmd.Runnable())
+}
+
+func TestWithTypedFlag(t *testing.T) {
+	execute := func(args ...string) (*cobra.Command, error) {
+		b := NewCobraCmd("send").WithNoOp()
+		cmd := WithTypedFlag(b, "from", (*mail.Address)(nil), "sender address", mail.ParseAddress).
+			WithBoolFlag("dry-run", false, "don't send").
+			Build()
+		cmd.SilenceErrors, cmd.SilenceUsage = true, true
+		cmd.SetArgs(args)
+		return cmd, cmd.Execute()
+	}
+
+	cmd, err := execute("--from", "Gopher <gopher@example.com>")
+	assert.NoError(t, err)
+	from, err := GetTyped[*mail.Address](cmd.Flags(), "from")
+	assert.NoError(t, err)
+	assert.Equal(t, &mail.Address{Name: "Gopher", Address: "gopher@example.com"}, from)
+	assert.Contains(t, cmd.UsageString(), "--from address")
+
+	_, err = execute("--from", "not an address")
+	assert.EqualError(t, err, `invalid argument "not an address" for "--from" flag: mail: no angle-addr`)
+
+	_, err = GetTyped[string](cmd.Flags(), "from")
+	assert.EqualError(t, err, "trying to get string value of flag of type address")
+}
+
+func TestCobraCmdBuilderMarkFlagRequired(t *testing.T) {
+	b := NewCobraCmd("app").
+		WithStringFlag("name", "", "name").
+		WithStringPersistentFlag("token", "", "api token").
+		MarkFlagRequired("name").
+		MarkPersistentFlagRequired("token").
+		WithNoOp()
+	assert.NoError(t, b.Err())
+	cmd := b.Build()
+	cmd.SilenceErrors, cmd.SilenceUsage = true, true
+
+	cmd.SetArgs([]string{"--token", "abc"})
+	assert.EqualError(t, cmd.Execute(), `required flag(s) "name" not set`)
+
+	b = NewCobraCmd("app").MarkFlagRequired("missing").MarkPersistentFlagRequired("missing")
+	assert.EqualError(t, b.Err(), "marking flag \"missing\" required: no such flag -missing\n"+
+		"marking persistent flag \"missing\" required: no such flag -missing")
+}
+
+func TestCobraCmdBuilderMarkFlagsMutuallyExclusive(t *testing.T) {
+	newBuilder := func() *CobraCmdBuilder {
+		return NewCobraCmd("app").
+			WithBoolFlag("json", false, "output json").
+			MarkFlagsMutuallyExclusive("json", "yaml").
+			WithBoolFlag("yaml", false, "output yaml").
+			WithNoOp()
+	}
+	cmd, err := newBuilder().BuildE()
+	assert.NoError(t, err)
+	cmd.SilenceErrors, cmd.SilenceUsage = true, true
+	cmd.SetArgs([]string{"--json", "--yaml"})
+	assert.EqualError(t, cmd.Execute(), "if any flags in the group [json yaml] are set none of the others can be; [json yaml] were all set")
+	assert.Contains(t, cmd.UsageString(), "--json   output json (can't be used with --yaml)")
+
+	cmd = newBuilder().Build()
+	cmd.SetArgs([]string{"--yaml"})
+	assert.NoError(t, cmd.Execute())
+
+	_, err = NewCobraCmd("app").WithBoolFlag("json", false, "output json").MarkFlagsMutuallyExclusive("json", "yaml").BuildE()
+	assert.EqualError(t, err, "marking flags [json yaml] mutually exclusive: no such flag -yaml")
+}
+
+func TestCobraCmdBuilderMarkFlagsRequiredTogether(t *testing.T) {
+	execute := func(args ...string) error {
+		cmd := NewCobraCmd("serve").
+			MarkFlagsRequiredTogether("tls-cert", "tls-key").
+			WithStringFlag("tls-cert", "", "tls certificate").
+			WithStringFlag("tls-key", "", "tls key").
+			WithNoOp().
+			Build()
+		cmd.SilenceErrors, cmd.SilenceUsage = true, true
+		cmd.SetArgs(args)
+		return cmd.Execute()
+	}
+
+	assert.EqualError(t, execute("--tls-cert", "cert.pem"),
+		"if any flags in the group [tls-cert tls-key] are set they must all be set; missing [tls-key]")
+	assert.NoError(t, execute("--tls-cert", "cert.pem", "--tls-key", "key.pem"))
+	assert.NoError(t, execute())
+
+	_, err := NewCobraCmd("serve").MarkFlagsRequiredTogether("tls-cert", "tls-key").BuildE()
+	assert.EqualError(t, err, "marking flags [tls-cert tls-key] required together: no such flag -tls-cert\n"+
+		"marking flags [tls-cert tls-key] required together: no such flag -tls-key")
+}
+
+func TestCobraCmdBuilderMarkFlagsOneRequired(t *testing.T) {
+	execute := func(args ...string) error {
+		cmd := NewCobraCmd("apply").
+			MarkFlagsOneRequired("file", "stdin", "url").
+			WithStringFlag("file", "", "file to apply").
+			WithBoolFlag("stdin", false, "read from stdin").
+			WithStringFlag("url", "", "url to apply").
+			WithNoOp().
+			Build()
+		cmd.SilenceErrors, cmd.SilenceUsage = true, true
+		cmd.SetArgs(args)
+		return cmd.Execute()
+	}
+
+	assert.EqualError(t, execute(), "at least one of the flags in the group [file stdin url] is required")
+	assert.NoError(t, execute("--stdin"))
+	assert.NoError(t, execute("--file", "app.yaml", "--url", "https://example.com"))
+
+	_, err := NewCobraCmd("apply").WithStringFlag("file", "", "file to apply").MarkFlagsOneRequired("file", "url").BuildE()
+	assert.EqualError(t, err, "marking flags [file url] one required: no such flag -url")
+}
+
+func TestCobraCmdBuilderWithExplainFlag(t *testing.T) {
+	cfg := NewViperCfg().WithDefault("log.level", "info")
+	ran := false
+	cmd := NewCobraCmd("deploy").
+		WithStringFlag("env", "dev", "environment to deploy to").
+		WithStringFlag("api-key", "", "key to call the API with").
+		WithPreRunFunc(func(cmd *cobra.Command, args []string) { ran = true }).
+		WithRunFunc(func(cmd *cobra.Command, args []string) { ran = true }).
+		WithExplainFlag(cfg).
+		Build()
+	stdout := new(bytes.Buffer)
+	cmd.SetOut(stdout)
+	cmd.SetArgs([]string{"--explain", "--env", "prod", "--api-key", "s3cret", "api"})
+	assert.NoError(t, cmd.Execute())
+	assert.False(t, ran)
+	assert.Equal(t, `Command: deploy
+Args: ["api"]
+Flags:
+  --api-key=[redacted] (set)
+  --env=prod (set)
+  --help=false (default)
+Config:
+log:
+  level: info # from default
+`, stdout.String())
+
+	var hooks []string
+	record := func(hook string) func(*cobra.Command, []string) {
+		return func(*cobra.Command, []string) { hooks = append(hooks, hook) }
+	}
+	sub := NewCobraCmd("api").
+		WithPersistentPreRunFunc(record("persistent pre-run")).
+		WithPreRunFunc(record("pre-run")).
+		WithRunFunc(record("run")).
+		WithPostRunFunc(record("post-run")).
+		Build()
+	cmd = NewCobraCmd("deploy").WithSubCommands(sub).WithExplainFlag(cfg).Build()
+	cmd.SetOut(new(bytes.Buffer))
+	cmd.SetArgs([]string{"api", "--explain"})
+	assert.NoError(t, cmd.Execute())
+	assert.Equal(t, []string{"persistent pre-run"}, hooks)
+	hooks = nil
+	cmd.SetArgs([]string{"api", "--explain=false"})
+	assert.NoError(t, cmd.Execute())
+	assert.Equal(t, []string{"persistent pre-run", "pre-run", "run", "post-run"}, hooks)
+}
+
+func TestCobraCmdBuilderBuildE(t *testing.T) {
+	cmd, err := NewCobraCmd("app").
+		WithBoolFlag("debug", false, "debug output").
+		MarkFlagHidden("debug").
+		BuildE()
+	assert.NoError(t, err)
+	assert.True(t, cmd.Flags().Lookup("debug").Hidden)
+
+	var b *CobraCmdBuilder
+	assert.NotPanics(t, func() {
+		b = NewCobraCmd("app").
+			MarkFlagHidden("missing").
+			MarkPersistentFlagDeprecated("old", "use --new instead")
+	})
+	cmd, err = b.BuildE()
+	assert.NotNil(t, cmd)
+	assert.EqualError(t, err, "flag \"missing\" does not exist\nflag \"old\" does not exist")
+	assert.Equal(t, err, b.Err())
+	assert.PanicsWithError(t, err.Error(), func() { b.Build() })
+}
+
+func TestCobraCmdBuilderWithFlagCompletionFunc(t *testing.T) {
+	var toComplete string
+	cmd := NewCobraCmd("deploy").
+		WithStringFlag("env", "dev", "environment to deploy to").
+		WithFlagCompletionFunc("env", func(cmd *cobra.Command, args []string, s string) ([]string, cobra.ShellCompDirective) {
+			toComplete = s
+			return []string{"dev", "prod"}, cobra.ShellCompDirectiveNoFileComp
+		}).
+		WithNoOp().
+		Build()
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetArgs([]string{cobra.ShellCompRequestCmd, "--env", "p"})
+	assert.NoError(t, cmd.Execute())
+	assert.Equal(t, "p", toComplete)
+	assert.Equal(t, fmt.Sprintf("dev\nprod\n:%d\n", cobra.ShellCompDirectiveNoFileComp), out.String())
+
+	b := NewCobraCmd("deploy").WithFlagCompletionFunc("env", nil)
+	assert.EqualError(t, b.Err(), "RegisterFlagCompletionFunc: flag 'env' does not exist")
+}
+
+func TestCobraCmdBuilderFlagsFromViper(t *testing.T) {
+	cfg := NewViperCfg().
+		WithConfigType("yaml").
+		ReadConfig(strings.NewReader("host: db.internal\ndebug: true\nport: 5433\ntimeout: 10s\ntags: [a, b]")).
+		Build()
+	newCmd := func(cfg *viper.Viper) *cobra.Command {
+		return NewCobraCmd("connect").
+			WithStringFlagFromViper(cfg, "host", "host", "localhost", "host to connect to").
+			WithBoolFlagFromViper(cfg, "debug", "debug", false, "debug output").
+			WithIntFlagFromViper(cfg, "port", "port", 5432, "port to connect to").
+			WithDurationFlagFromViper(cfg, "timeout", "timeout", 5*time.Second, "connection timeout").
+			WithStringSliceFlagFromViper(cfg, "tags", "tag", nil, "connection tags").
+			Build()
+	}
+
+	flags := newCmd(cfg).Flags()
+	host, _ := flags.GetString("host")
+	debug, _ := flags.GetBool("debug")
+	port, _ := flags.GetInt("port")
+	timeout, _ := flags.GetDuration("timeout")
+	tags, _ := flags.GetStringSlice("tag")
+	assert.Equal(t, "db.internal", host)
+	assert.True(t, debug)
+	assert.Equal(t, 5433, port)
+	assert.Equal(t, 10*time.Second, timeout)
+	assert.Equal(t, []string{"a", "b"}, tags)
+	assert.Equal(t, "db.internal", flags.Lookup("host").DefValue)
+
+	flags = newCmd(viper.New()).Flags()
+	host, _ = flags.GetString("host")
+	debug, _ = flags.GetBool("debug")
+	port, _ = flags.GetInt("port")
+	timeout, _ = flags.GetDuration("timeout")
+	tags, _ = flags.GetStringSlice("tag")
+	assert.Equal(t, "localhost", host)
+	assert.False(t, debug)
+	assert.Equal(t, 5432, port)
+	assert.Equal(t, 5*time.Second, timeout)
+	assert.Empty(t, tags)
+}
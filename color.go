@@ -0,0 +1,74 @@
+package boa
+
+import (
+	"os"
+	"strings"
+)
+
+// ColorTheme holds the styles used to color help and usage text. Each style
+// is the parameters of an ANSI SGR escape sequence, such as "1" for bold or
+// "1;36" for bold cyan, and an empty style leaves text uncolored.
+type ColorTheme struct {
+	// Heading styles section headings, such as "Options:".
+	Heading string
+	// Option styles the args of options and profiles.
+	Option string
+	// Description styles the descriptions of options and profiles.
+	Description string
+}
+
+// DefaultColorTheme is a theme with bold headings and cyan options.
+var DefaultColorTheme = ColorTheme{Heading: "1", Option: "36"}
+
+// useColor returns whether help written to a terminal, or not, should be
+// colored with the Command's theme. Colors are disabled when NO_COLOR is set,
+// as described at https://no-color.org.
+func (c Command) useColor(tty bool) bool {
+	_, noColor := os.LookupEnv("NO_COLOR")
+	return c.theme != nil && tty && !noColor
+}
+
+// Heading returns the section heading s, colored by the theme if colors are
+// enabled; this is primarily used for templating purposes.
+func (c Command) Heading(s string) string {
+	return c.style(c.themeStyle(func(t ColorTheme) string { return t.Heading }), s)
+}
+
+// OptionName returns the args s of an option or profile, colored by the
+// theme if colors are enabled; this is primarily used for templating
+// purposes.
+func (c Command) OptionName(s string) string {
+	return c.style(c.themeStyle(func(t ColorTheme) string { return t.Option }), s)
+}
+
+// Describe returns the description s of an option or profile, colored by the
+// theme if colors are enabled; this is primarily used for templating
+// purposes. Each line is colored separately, so that text wrapped onto
+// several lines keeps its color.
+func (c Command) Describe(s string) string {
+	sgr := c.themeStyle(func(t ColorTheme) string { return t.Description })
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = c.style(sgr, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// themeStyle returns the style picked from the theme by field, or an empty
+// style if colors are disabled.
+func (c Command) themeStyle(field func(ColorTheme) string) string {
+	if !c.colorize {
+		return ""
+	}
+	return field(*c.theme)
+}
+
+// style wraps s in the escape sequences of the SGR style sgr. Even empty text
+// is wrapped, so that every cell of a tabwriter column gets the same number
+// of invisible bytes and the columns stay aligned.
+func (c Command) style(sgr string, s string) string {
+	if sgr == "" {
+		return s
+	}
+	return "\x1b[" + sgr + "m" + s + "\x1b[0m"
+}
@@ -0,0 +1,76 @@
+package boa
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/adrg/xdg"
+	"github.com/spf13/cobra"
+)
+
+// completionTarget returns where the completion script for the command name
+// is conventionally installed for shell. It is a variable so that tests can
+// install somewhere else.
+var completionTarget = func(shell string, name string) (string, error) {
+	switch shell {
+	case "bash":
+		return filepath.Join(xdg.DataHome, "bash-completion", "completions", name), nil
+	case "zsh":
+		return filepath.Join(xdg.Home, ".zsh", "completions", "_"+name), nil
+	case "fish":
+		return filepath.Join(xdg.ConfigHome, "fish", "completions", name+".fish"), nil
+	}
+	return "", fmt.Errorf("unsupported shell %q, expected bash, zsh or fish", shell)
+}
+
+// WithInstallCompletionCmd adds an install-completion subcommand that detects
+// the user's shell from $SHELL, writes the completion script for the root
+// command to the conventional location for that shell and prints how to
+// activate it. bash, zsh and fish are supported.
+func (b *CobraCmdBuilder) WithInstallCompletionCmd() *CobraCmdBuilder {
+	b.cmd.AddCommand(newInstallCompletionCmd())
+	return b
+}
+
+func newInstallCompletionCmd() *cobra.Command {
+	return NewCobraCmd("install-completion").
+		WithShortDescription("Install the completion script for your shell").
+		WithLongDescription("Install the completion script for the shell set in $SHELL. bash, zsh and fish are supported.").
+		WithArgs(cobra.NoArgs).
+		WithRunEFunc(func(cmd *cobra.Command, args []string) error {
+			root := cmd.Root()
+			shell := filepath.Base(os.Getenv("SHELL"))
+			target, err := completionTarget(shell, root.Name())
+			if err != nil {
+				return err
+			}
+			script := new(bytes.Buffer)
+			var activate string
+			switch shell {
+			case "bash":
+				err = root.GenBashCompletionV2(script, true)
+				activate = "Completions will be loaded in new shells if bash-completion is installed."
+			case "zsh":
+				err = root.GenZshCompletion(script)
+				activate = fmt.Sprintf("Add the following to ~/.zshrc, then start a new shell:\n\n"+
+					"  fpath=(%s $fpath)\n  autoload -U compinit; compinit", filepath.Dir(target))
+			case "fish":
+				err = root.GenFishCompletion(script, true)
+				activate = "Completions will be loaded in new shells."
+			}
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			if err := os.WriteFile(target, script.Bytes(), 0o644); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Installed %s completion to %s\n%s\n", shell, target, activate)
+			return nil
+		}).
+		Build()
+}
@@ -0,0 +1,53 @@
+package boa
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adrg/xdg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompletionTarget(t *testing.T) {
+	target, err := completionTarget("bash", "app")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(xdg.DataHome, "bash-completion", "completions", "app"), target)
+	target, err = completionTarget("zsh", "app")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(xdg.Home, ".zsh", "completions", "_app"), target)
+	target, err = completionTarget("fish", "app")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(xdg.ConfigHome, "fish", "completions", "app.fish"), target)
+	_, err = completionTarget("tcsh", "app")
+	assert.EqualError(t, err, `unsupported shell "tcsh", expected bash, zsh or fish`)
+}
+
+func TestWithInstallCompletionCmd(t *testing.T) {
+	defer func(f func(string, string) (string, error)) { completionTarget = f }(completionTarget)
+	dir := t.TempDir()
+	completionTarget = func(shell string, name string) (string, error) {
+		return filepath.Join(dir, shell, name), nil
+	}
+
+	tests := map[string]string{
+		"bash": "# bash completion V2 for app",
+		"zsh":  "#compdef app",
+		"fish": "# fish completion for app",
+	}
+	for shell, header := range tests {
+		t.Setenv("SHELL", "/usr/bin/"+shell)
+		cmd := NewCobraCmd("app").WithNoOp().WithInstallCompletionCmd().Build()
+		out := new(bytes.Buffer)
+		cmd.SetOut(out)
+		cmd.SetArgs([]string{"install-completion"})
+		assert.NoError(t, cmd.Execute())
+
+		target := filepath.Join(dir, shell, "app")
+		script, err := os.ReadFile(target)
+		assert.NoError(t, err)
+		assert.Contains(t, string(script), header)
+		assert.Contains(t, out.String(), "Installed "+shell+" completion to "+target)
+	}
+}
@@ -0,0 +1,70 @@
+package boa
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// WithConfigFromDir reads config from a directory in which each file is a
+// config key whose value is the file's contents, less any trailing newline.
+// This is how a Kubernetes ConfigMap or Secret is projected when mounted as
+// a volume. Hidden files, such as the "..data" links Kubernetes maintains,
+// and subdirectories are ignored, as is dir if it doesn't exist.
+//
+// The values are merged into the config file layer, taking precedence over
+// the config file, and are merged again whenever the config is read.
+func (b *ViperCfgBuilder) WithConfigFromDir(dir string) *ViperCfgBuilder {
+	if !exists(dir) {
+		return b
+	}
+	b.configDirs = append(b.configDirs, dir)
+	if err := mergeConfigDir(b.cfg, dir); err != nil {
+		log.Fatalf("Error reading config dir: %v", err)
+	}
+	return b
+}
+
+// mergeConfigDirs merges the config dirs into v.
+func (b *ViperCfgBuilder) mergeConfigDirs(v *viper.Viper) error {
+	for _, dir := range b.configDirs {
+		if err := mergeConfigDir(v, dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeConfigDir merges the key files in dir into v.
+func mergeConfigDir(v *viper.Viper, dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("reading config dir %s: %w", dir, err)
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("reading config dir %s: %w", dir, err)
+		}
+		if info.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("reading config dir %s: %w", dir, err)
+		}
+		value := strings.TrimSuffix(string(data), "\n")
+		if err := v.MergeConfigMap(nestedMap(e.Name(), value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package boa
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// ConfirmFlagName is the name of the flag registered by WithConfirmation to
+// skip the confirmation prompt.
+const ConfirmFlagName = "yes"
+
+var (
+	// ErrNotConfirmed is returned when the user declines to confirm a command.
+	ErrNotConfirmed = errors.New("command not confirmed")
+	// ErrConfirmationRequired is returned when a command needs confirming but
+	// stdin isn't a terminal to prompt on.
+	ErrConfirmationRequired = errors.New("confirmation required, pass --" + ConfirmFlagName + " to run non-interactively")
+)
+
+// WithConfirmation is used to make destructive commands prompt the user to
+// confirm before running, e.g. "Are you sure? (y/N)". prompt defaults to
+// "Are you sure?" when empty. A persistent --yes/-y flag is registered to
+// skip the prompt, and the command fails with ErrConfirmationRequired when
+// stdin isn't a terminal and --yes wasn't passed.
+func (b *BoaCmdBuilder) WithConfirmation(prompt string) *BoaCmdBuilder {
+	if prompt == "" {
+		prompt = "Are you sure?"
+	}
+	yes := b.cmd.PersistentFlags().BoolP(ConfirmFlagName, "y", false, "skip the confirmation prompt")
+	b.beforePreRun(func(cmd *cobra.Command, args []string) error {
+		if *yes {
+			return nil
+		}
+		if !isTerminal(cmd.InOrStdin()) {
+			return ErrConfirmationRequired
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "%s (y/N) ", prompt)
+		answer, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+		if err != nil && answer == "" {
+			return ErrNotConfirmed
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			return nil
+		}
+		return ErrNotConfirmed
+	})
+	return b
+}
@@ -0,0 +1,71 @@
+package boa
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type valueDecryptor struct {
+	prefix  string
+	decrypt func(string) (string, error)
+}
+
+// decryptedValue is the encrypted value of a config key and its plaintext.
+type decryptedValue struct {
+	encrypted string
+	plain     string
+}
+
+// WithValueDecryptor decrypts every string value starting with prefix once
+// the configuration has been read, e.g. with a prefix of "ENC[" for
+//
+//	password: ENC[AES256_GCM,data:...]
+//
+// decrypt is given the whole value, prefix included, and returns the
+// plaintext. This lets secrets encrypted by tools such as SOPS or age live in
+// config files alongside plain values. Reading fails if decrypt returns an
+// error.
+//
+// The plaintext is only kept in memory: writing the configuration back with
+// WriteConfig, WriteConfigAs or SafeWriteConfigAs writes the encrypted value
+// of each decrypted key instead, and DumpConfig and LayerReport redact it.
+func (b *ViperCfgBuilder) WithValueDecryptor(prefix string, decrypt func(string) (string, error)) *ViperCfgBuilder {
+	b.decryptors = append(b.decryptors, valueDecryptor{prefix, decrypt})
+	return b
+}
+
+// decryptValues decrypts the string values carrying the prefix of a
+// decryptor, remembering the values of each key decrypted.
+func (b *ViperCfgBuilder) decryptValues() error {
+	b.decrypted = nil
+	if len(b.decryptors) == 0 {
+		return nil
+	}
+	keys := b.cfg.AllKeys()
+	sort.Strings(keys)
+	for _, k := range keys {
+		v, ok := b.cfg.Get(k).(string)
+		if !ok {
+			continue
+		}
+		for _, d := range b.decryptors {
+			if !strings.HasPrefix(v, d.prefix) {
+				continue
+			}
+			plain, err := d.decrypt(v)
+			if err != nil {
+				return fmt.Errorf("decrypting config key %q: %w", k, err)
+			}
+			if err := b.cfg.MergeConfigMap(nestedMap(k, plain)); err != nil {
+				return err
+			}
+			if b.decrypted == nil {
+				b.decrypted = map[string]decryptedValue{}
+			}
+			b.decrypted[k] = decryptedValue{v, plain}
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package boa
+
+import (
+	"io"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DumpConfig writes the configuration to w as YAML in which each key is
+// annotated with a comment naming the layer its value came from, such as
+// flag, env, file or default, as reported by LayerReport. The result doubles
+// as documentation of the effective config and as a diagnostic that can be
+// attached to bug reports, so the values of secrets, such as those read from
+// Vault or decrypted by WithValueDecryptor, are redacted.
+func (b *ViperCfgBuilder) DumpConfig(w io.Writer) error {
+	layers := b.layers()
+	keys := b.cfg.AllKeys()
+	sort.Strings(keys)
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	for _, k := range keys {
+		parent := root
+		path := strings.Split(k, ".")
+		for _, name := range path[:len(path)-1] {
+			parent = mappingChild(parent, name)
+		}
+		v := b.cfg.Get(k)
+		if b.isSecret(k) {
+			v = redacted
+		}
+		value := new(yaml.Node)
+		if err := value.Encode(v); err != nil {
+			return err
+		}
+		name := &yaml.Node{Kind: yaml.ScalarNode, Value: path[len(path)-1]}
+		if value.Kind == yaml.ScalarNode {
+			value.LineComment = "from " + source(layers, k)
+		} else {
+			name.LineComment = "from " + source(layers, k)
+		}
+		parent.Content = append(parent.Content, name, value)
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{root}}); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// mappingChild returns the mapping node under name in the mapping node
+// parent, adding it if it doesn't exist yet.
+func mappingChild(parent *yaml.Node, name string) *yaml.Node {
+	for i := 0; i < len(parent.Content); i += 2 {
+		if parent.Content[i].Value == name {
+			return parent.Content[i+1]
+		}
+	}
+	child := &yaml.Node{Kind: yaml.MappingNode}
+	parent.Content = append(parent.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name}, child)
+	return child
+}
@@ -0,0 +1,60 @@
+package boa
+
+import (
+	"fmt"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// WithEnvHelp appends an "Environment Variables:" section to the help text
+// of cmd, listing the env var that sets each known config key, with the env
+// prefix and key replacer applied. Keys are only listed if they're bound to
+// an env var or automatic env is enabled.
+//
+// The current help function of cmd is extended, so this should be called
+// after setting a custom help function or template.
+func (b *ViperCfgBuilder) WithEnvHelp(cmd *cobra.Command) *ViperCfgBuilder {
+	help := cmd.HelpFunc()
+	cmd.SetHelpFunc(func(cmd *cobra.Command, args []string) {
+		help(cmd, args)
+		vars := b.envVars()
+		if len(vars) == 0 {
+			return
+		}
+		keys := make([]string, 0, len(vars))
+		for k := range vars {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 3, 3, 3, ' ', 0)
+		fmt.Fprintln(w, "\nEnvironment Variables:")
+		for _, k := range keys {
+			fmt.Fprintf(w, "  %s\t%s\n", vars[k], k)
+		}
+		w.Flush()
+	})
+	return b
+}
+
+// envVars returns the env var that sets each known key that can be set by
+// one.
+func (b *ViperCfgBuilder) envVars() map[string]string {
+	vars := map[string]string{}
+	for _, k := range b.cfg.AllKeys() {
+		name := ""
+		if b.automaticEnv {
+			name = b.envName(k)
+		} else if names := b.boundEnvs[k]; len(names) > 0 {
+			name = names[0]
+		} else {
+			continue
+		}
+		if b.envReplacer != nil {
+			name = b.envReplacer.Replace(name)
+		}
+		vars[k] = name
+	}
+	return vars
+}
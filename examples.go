@@ -0,0 +1,183 @@
+package boa
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// ExampleError reports an example that doesn't parse against its command.
+type ExampleError struct {
+	Example string
+	Err     error
+}
+
+func (e ExampleError) Error() string {
+	return fmt.Sprintf("invalid example %q: %v", e.Example, e.Err)
+}
+
+func (e ExampleError) Unwrap() error {
+	return e.Err
+}
+
+// ValidateExamples checks that every line of the boa Command's Example that
+// invokes the CLI, i.e. begins with the root command's name (optionally
+// after a "$ " prompt), parses against the command tree. The flags and args
+// of each example are parsed and validated as they would be on execution,
+// but nothing is run. An ExampleError is reported for every example that
+// references an unknown command or flag, or fails arg validation.
+//
+// This is intended for tests and CI so that examples don't go stale as
+// commands and flags change.
+func ValidateExamples(cmd *Command) error {
+	root := cmd.Root()
+	var errs []error
+	for _, line := range strings.Split(cmd.Example, "\n") {
+		example := strings.TrimPrefix(strings.TrimSpace(line), "$ ")
+		args, err := splitArgs(example)
+		if err != nil {
+			errs = append(errs, ExampleError{example, err})
+			continue
+		}
+		if len(args) == 0 || args[0] != root.Name() {
+			continue
+		}
+		if err := validateArgs(root, args[1:]); err != nil {
+			errs = append(errs, ExampleError{example, err})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validateArgs resolves args against the command tree rooted at root and
+// parses them, restoring any flags they change.
+func validateArgs(root *cobra.Command, args []string) error {
+	cmd, args, err := root.Find(args)
+	if err != nil {
+		return err
+	}
+	cmd.InitDefaultHelpFlag()
+	cmd.InitDefaultVersionFlag()
+	defer restoreFlags(cmd.Flags())()
+	if err := cmd.ParseFlags(args); err != nil {
+		return err
+	}
+	return cmd.ValidateArgs(cmd.Flags().Args())
+}
+
+// restoreFlags records the state of every flag in fs and returns a function
+// that restores it.
+func restoreFlags(fs *pflag.FlagSet) func() {
+	type state struct {
+		value   string
+		slice   []string
+		changed bool
+	}
+	states := map[*pflag.Flag]state{}
+	fs.VisitAll(func(f *pflag.Flag) {
+		s := state{value: f.Value.String(), changed: f.Changed}
+		if sv, ok := f.Value.(pflag.SliceValue); ok {
+			s.slice = sv.GetSlice()
+		}
+		states[f] = s
+	})
+	return func() {
+		fs.VisitAll(func(f *pflag.Flag) {
+			s, ok := states[f]
+			if !ok || !f.Changed {
+				return
+			}
+			if sv, ok := f.Value.(pflag.SliceValue); ok {
+				sv.Replace(s.slice)
+			} else {
+				f.Value.Set(s.value)
+			}
+			f.Changed = s.changed
+		})
+	}
+}
+
+// splitArgs splits s into args the way a POSIX shell would, honouring single
+// quotes, double quotes and backslash escapes.
+func splitArgs(s string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			arg.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inArg = true, true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, errors.New("unterminated quote or escape")
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// ShellQuote joins args into a command line that a POSIX shell splits back
+// into the same args, quoting any arg that contains spaces, quotes or other
+// special characters. This keeps examples generated from structured data,
+// such as those given to WithExample, copy-pasteable.
+func ShellQuote(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuoteArg(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// shellQuoteArg single quotes arg if it contains anything but characters
+// that are never special to the shell.
+func shellQuoteArg(arg string) string {
+	if arg == "" {
+		return "''"
+	}
+	safe := true
+	for _, r := range arg {
+		if !strings.ContainsRune(shellSafeChars, r) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+const shellSafeChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_@%+=:,./-"
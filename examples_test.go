@@ -0,0 +1,61 @@
+package boa
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateExamples(t *testing.T) {
+	example := `  # install some tools
+  $ mycli install kubectl --force
+  mycli install "helm" -f
+  mycli install kubectl --removed
+  mycli install skaffold`
+	install := NewCmd("install").
+		WithValidOptions(
+			Option{Args: []string{"kubectl"}, Desc: "install kubectl"},
+			Option{Args: []string{"helm"}, Desc: "install helm"},
+		).
+		WithMinValidArgs(1).
+		WithExample(example).
+		WithBoolPFlag("force", "f", false, "force the install").
+		WithNoOp().
+		BuildBoaCmd()
+	NewCobraCmd("mycli").WithSubCommands(install.Command)
+
+	err := ValidateExamples(install)
+	var exampleErrs []ExampleError
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var exampleErr ExampleError
+		assert.True(t, errors.As(e, &exampleErr))
+		exampleErrs = append(exampleErrs, exampleErr)
+	}
+	assert.Len(t, exampleErrs, 2)
+	assert.Equal(t, "mycli install kubectl --removed", exampleErrs[0].Example)
+	assert.Equal(t, "mycli install skaffold", exampleErrs[1].Example)
+
+	force, _ := install.Flags().GetBool("force")
+	assert.False(t, force)
+	assert.False(t, install.Flags().Changed("force"))
+
+	valid := NewCmd("valid").WithExample("valid --help").WithRunFunc(func(*cobra.Command, []string) {}).BuildBoaCmd()
+	assert.NoError(t, ValidateExamples(valid))
+}
+
+func TestShellQuote(t *testing.T) {
+	args := []string{"deploy", "--name", "my app", "it's", `say "hi"`, "$HOME", "a;b", "", "key=value", "*.go"}
+	quoted := ShellQuote(args)
+	assert.Equal(t, `deploy --name 'my app' 'it'\''s' 'say "hi"' '$HOME' 'a;b' '' key=value '*.go'`, quoted)
+
+	split, err := splitArgs(quoted)
+	assert.NoError(t, err)
+	assert.Equal(t, args, split)
+
+	buf := new(bytes.Buffer)
+	assert.NoError(t, tmpl(buf, `app {{shellQuote .}}`, []string{"get", "two words"}))
+	assert.Equal(t, "app get 'two words'", buf.String())
+}
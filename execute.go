@@ -0,0 +1,29 @@
+package boa
+
+import (
+	"context"
+	"os/signal"
+	"syscall"
+)
+
+// ExecuteWith executes cmd by passing its Execute method to hook, so that
+// cross-cutting concerns such as starting a trace span or recovering panics
+// can be wrapped around the whole execution in one place. hook is expected to
+// call run and return its error, or an error of its own.
+func ExecuteWith(cmd *Command, hook func(run func() error) error) error {
+	return hook(cmd.Execute)
+}
+
+// ExecuteWithSignalHandler executes c with a context that's cancelled when
+// the process receives SIGINT or SIGTERM, so that run functions can stop
+// cleanly on Ctrl-C by watching cmd.Context(). The context is derived from
+// the one set with WithContext, if any.
+func (c *Command) ExecuteWithSignalHandler() error {
+	ctx := c.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	return c.ExecuteContext(ctx)
+}
@@ -0,0 +1,138 @@
+package boa
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// ExitError is an error that carries the code the program should exit with.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode returns the code the program should exit with after executing a
+// command returned err: 0 for nil, the code of an ExitError in err's chain,
+// and 1 otherwise. It is typically used as os.Exit(boa.ExitCode(err)).
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+	return 1
+}
+
+// WithHelpExitCode is used to show the command's help when it's given
+// invalid args or flags, failing with an ExitError carrying code, so that
+// scripts can tell a usage error apart from help they asked for. Explicitly
+// asking for help with --help still succeeds, so ExitCode returns 0 for it.
+//
+// The command's args validator is wrapped when the command is built, so it
+// may be set before or after this is called. Without one, cobra's default of
+// rejecting unknown subcommands of a root command is kept. cobra only
+// validates the args of a command with a run function, so a root command
+// without one is given a run function that shows its help, and its usage line
+// is shown in help like that of any runnable command.
+func (b *CobraCmdBuilder) WithHelpExitCode(code int) *CobraCmdBuilder {
+	helpErr := func(cmd *cobra.Command, err error) error {
+		cmd.SilenceUsage = true
+		if helpErr := cmd.Help(); helpErr != nil {
+			return helpErr
+		}
+		return &ExitError{Code: code, Err: err}
+	}
+	b.onBuild = append(b.onBuild, func() {
+		validate := b.cmd.Args
+		if validate == nil {
+			validate = legacyArgs
+		}
+		b.cmd.Args = func(cmd *cobra.Command, args []string) error {
+			if err := validate(cmd, args); err != nil {
+				return helpErr(cmd, err)
+			}
+			return nil
+		}
+		if b.cmd.Runnable() || b.cmd.HasParent() || !b.cmd.HasSubCommands() {
+			return
+		}
+		b.cmd.RunE = func(cmd *cobra.Command, args []string) error {
+			if b.requireSubcommand {
+				return errRequiresSubcommand(cmd)
+			}
+			return cmd.Help()
+		}
+	})
+	next := b.cmd.FlagErrorFunc()
+	b.cmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return helpErr(cmd, next(cmd, err))
+	})
+	return b
+}
+
+// legacyArgs validates args the way cobra does for a command without an args
+// validator: a root command with subcommands rejects any args as unknown
+// subcommands, suggesting the ones they're close to, while other commands
+// accept any args.
+func legacyArgs(cmd *cobra.Command, args []string) error {
+	if !cmd.HasSubCommands() || cmd.HasParent() || len(args) == 0 {
+		return nil
+	}
+	suggestions := ""
+	if !cmd.DisableSuggestions {
+		if cmd.SuggestionsMinimumDistance <= 0 {
+			cmd.SuggestionsMinimumDistance = 2
+		}
+		if s := cmd.SuggestionsFor(args[0]); len(s) > 0 {
+			suggestions = "\n\nDid you mean this?\n"
+			for _, name := range s {
+				suggestions += fmt.Sprintf("\t%v\n", name)
+			}
+		}
+	}
+	return fmt.Errorf("unknown command %q for %q%s", args[0], cmd.CommandPath(), suggestions)
+}
+
+// WithHelpOnNoArgs is used to choose what a command without a run function,
+// such as a root command that only groups subcommands, does when invoked
+// without a subcommand. When enabled it prints its help and succeeds, which
+// is what cobra does by default; when disabled it fails with an error saying
+// a subcommand is required, so that ExitCode returns 1.
+//
+// Whether the command has a run function is decided when it's built, so a
+// run function may be set before or after this is called, and takes
+// precedence. When disabled, the command is given a run function of its own,
+// so its usage line is shown in help like that of any runnable command.
+func (b *CobraCmdBuilder) WithHelpOnNoArgs(enabled bool) *CobraCmdBuilder {
+	b.requireSubcommand = !enabled
+	if enabled {
+		return b
+	}
+	b.onBuild = append(b.onBuild, func() {
+		if b.cmd.Runnable() {
+			return
+		}
+		b.cmd.RunE = func(cmd *cobra.Command, args []string) error {
+			return errRequiresSubcommand(cmd)
+		}
+	})
+	return b
+}
+
+// errRequiresSubcommand returns the error of a command invoked without one of
+// its subcommands.
+func errRequiresSubcommand(cmd *cobra.Command) error {
+	return fmt.Errorf("%q requires a subcommand", cmd.CommandPath())
+}
@@ -0,0 +1,94 @@
+package boa
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// ExplainFlagName is the name of the flag registered by WithExplainFlag.
+const ExplainFlagName = "explain"
+
+// WithExplainFlag registers a persistent --explain flag that, when set, makes
+// the executed command print its arguments, the value of each of its flags
+// and, for each of cfgs, the effective config it would use, as written by
+// DumpConfig, instead of running. Unlike a --dry-run flag, which still runs
+// the command's read-only logic, the command's PreRun, Run and PostRun
+// functions aren't called at all; persistent pre-run functions still are, so
+// that the config they read can be explained. As with WithTraceFlag, the
+// values of flags whose names look like they hold secrets are redacted.
+//
+// The flag is checked each time a command is executed, by wrapping the
+// functions of the command and its subcommands when it's built, so
+// subcommands should be added before then.
+func (b *CobraCmdBuilder) WithExplainFlag(cfgs ...*ViperCfgBuilder) *CobraCmdBuilder {
+	b.cmd.PersistentFlags().Bool(ExplainFlagName, false, "print what the command would do instead of running it")
+	b.onBuild = append(b.onBuild, func() {
+		walk(b.cmd, func(cmd *cobra.Command) {
+			cmd.PreRun, cmd.PreRunE = nil, unlessExplaining(cmd.PreRunE, cmd.PreRun)
+			cmd.PostRun, cmd.PostRunE = nil, unlessExplaining(cmd.PostRunE, cmd.PostRun)
+			wrapRun(cmd, func(next runFunc) runFunc {
+				return func(cmd *cobra.Command, args []string) error {
+					if explaining(cmd) {
+						return explain(cfgs)(cmd, args)
+					}
+					return next(cmd, args)
+				}
+			})
+		})
+	})
+	return b
+}
+
+// explaining returns whether cmd is being executed with --explain.
+func explaining(cmd *cobra.Command) bool {
+	on, _ := cmd.Flags().GetBool(ExplainFlagName)
+	return on
+}
+
+// unlessExplaining returns a function that runs prevE or prev, whichever is
+// set, unless the command is being explained, or nil if neither is set.
+func unlessExplaining(prevE runFunc, prev func(cmd *cobra.Command, args []string)) runFunc {
+	if prevE == nil && prev == nil {
+		return nil
+	}
+	return func(cmd *cobra.Command, args []string) error {
+		if explaining(cmd) {
+			return nil
+		}
+		if prevE != nil {
+			return prevE(cmd, args)
+		}
+		prev(cmd, args)
+		return nil
+	}
+}
+
+// explain returns a run function that prints the arguments and flags it's
+// given and the effective config of each of cfgs.
+func explain(cfgs []*ViperCfgBuilder) runFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		w := cmd.OutOrStdout()
+		fmt.Fprintf(w, "Command: %s\n", cmd.CommandPath())
+		fmt.Fprintf(w, "Args: %q\n", args)
+		fmt.Fprintln(w, "Flags:")
+		cmd.Flags().VisitAll(func(f *pflag.Flag) {
+			if f.Name == ExplainFlagName {
+				return
+			}
+			source := "default"
+			if f.Changed {
+				source = "set"
+			}
+			fmt.Fprintf(w, "  --%s=%s (%s)\n", f.Name, flagValue(f), source)
+		})
+		for _, cfg := range cfgs {
+			fmt.Fprintln(w, "Config:")
+			if err := cfg.DumpConfig(w); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
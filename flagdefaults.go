@@ -0,0 +1,48 @@
+package boa
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// WithFlagDefaultsFromConfig makes the usage and help text of cmd, and of
+// its subcommands, show the default of each flag as the value the config
+// provides for it, from env vars, the config file or config defaults, rather
+// than the flag's hardcoded default. Flags bound with WithBoundPFlag use the
+// key they're bound to, and other flags the key of the same name; flags
+// without a config value keep their default.
+//
+// The current usage and help functions of cmd are extended, so this should
+// be called after setting custom ones.
+func (b *ViperCfgBuilder) WithFlagDefaultsFromConfig(cmd *cobra.Command) *ViperCfgBuilder {
+	usage, help := cmd.UsageFunc(), cmd.HelpFunc()
+	cmd.SetUsageFunc(func(cmd *cobra.Command) error {
+		b.syncFlagDefaults(cmd)
+		return usage(cmd)
+	})
+	cmd.SetHelpFunc(func(cmd *cobra.Command, args []string) {
+		b.syncFlagDefaults(cmd)
+		help(cmd, args)
+	})
+	return b
+}
+
+// syncFlagDefaults sets the default shown for each flag of cmd to its config
+// value.
+func (b *ViperCfgBuilder) syncFlagDefaults(cmd *cobra.Command) {
+	keys := map[*pflag.Flag]string{}
+	for k, f := range b.boundFlags {
+		keys[f] = k
+	}
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		key, ok := keys[f]
+		if !ok {
+			key = f.Name
+		}
+		if b.cfg.IsSet(key) {
+			f.DefValue = fmt.Sprint(b.cfg.Get(key))
+		}
+	})
+}
@@ -0,0 +1,419 @@
+package boa
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// enumValue is a string flag value that only accepts one of a fixed set of
+// values.
+type enumValue struct {
+	value   *string
+	allowed []string
+}
+
+func newEnumValue(value string, p *string, allowed []string) *enumValue {
+	*p = value
+	return &enumValue{value: p, allowed: allowed}
+}
+
+func (e *enumValue) Set(s string) error {
+	for _, a := range e.allowed {
+		if s == a {
+			*e.value = s
+			return nil
+		}
+	}
+	return fmt.Errorf("must be one of %s", strings.Join(e.allowed, ", "))
+}
+
+func (e *enumValue) String() string {
+	return *e.value
+}
+
+// Type lists the allowed values, so that they're shown in the usage text.
+func (e *enumValue) Type() string {
+	return strings.Join(e.allowed, "|")
+}
+
+// WithEnumFlag defines a string flag with specified name, allowed values,
+// default value, and usage string. Setting the flag to a value that isn't
+// allowed fails with an error listing the allowed values, and shells
+// complete the flag with them.
+func (b *CobraCmdBuilder) WithEnumFlag(name string, allowed []string, value string, usage string) *CobraCmdBuilder {
+	return b.WithEnumVarPFlag(new(string), name, "", allowed, value, usage)
+}
+
+// WithEnumPFlag is like WithEnumFlag, but accepts a shorthand letter that can
+// be used after a single dash.
+func (b *CobraCmdBuilder) WithEnumPFlag(name string, shorthand string, allowed []string, value string, usage string) *CobraCmdBuilder {
+	return b.WithEnumVarPFlag(new(string), name, shorthand, allowed, value, usage)
+}
+
+// WithEnumVarFlag is like WithEnumFlag, but stores the value of the flag in
+// variable.
+func (b *CobraCmdBuilder) WithEnumVarFlag(variable *string, name string, allowed []string, value string, usage string) *CobraCmdBuilder {
+	return b.WithEnumVarPFlag(variable, name, "", allowed, value, usage)
+}
+
+// WithEnumVarPFlag is like WithEnumVarFlag, but accepts a shorthand letter
+// that can be used after a single dash.
+func (b *CobraCmdBuilder) WithEnumVarPFlag(variable *string, name string, shorthand string, allowed []string, value string, usage string) *CobraCmdBuilder {
+	b.cmd.Flags().VarP(newEnumValue(value, variable, allowed), name, shorthand, usage)
+	err := b.cmd.RegisterFlagCompletionFunc(name, func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+		return allowed, cobra.ShellCompDirectiveNoFileComp
+	})
+	if err != nil {
+		b.errs = append(b.errs, err)
+	}
+	return b
+}
+
+// timeValue is a flag value that parses times with a layout.
+type timeValue struct {
+	value  *time.Time
+	layout string
+}
+
+func newTimeValue(value time.Time, p *time.Time, layout string) *timeValue {
+	*p = value
+	return &timeValue{value: p, layout: layout}
+}
+
+func (t *timeValue) Set(s string) error {
+	v, err := time.Parse(t.layout, s)
+	if err != nil {
+		return fmt.Errorf("expected a time in the layout %q", t.layout)
+	}
+	*t.value = v
+	return nil
+}
+
+func (t *timeValue) String() string {
+	if t.value.IsZero() {
+		return ""
+	}
+	return t.value.Format(t.layout)
+}
+
+func (t *timeValue) Type() string {
+	return "time"
+}
+
+// WithTimeFlag defines a time.Time flag with specified name, layout, default
+// value, and usage string. Values are parsed with time.Parse using layout,
+// e.g. time.RFC3339 or "2006-01-02".
+func (b *CobraCmdBuilder) WithTimeFlag(name string, layout string, value time.Time, usage string) *CobraCmdBuilder {
+	return b.WithTimeVarPFlag(new(time.Time), name, "", layout, value, usage)
+}
+
+// WithTimePFlag is like WithTimeFlag, but accepts a shorthand letter that can
+// be used after a single dash.
+func (b *CobraCmdBuilder) WithTimePFlag(name string, shorthand string, layout string, value time.Time, usage string) *CobraCmdBuilder {
+	return b.WithTimeVarPFlag(new(time.Time), name, shorthand, layout, value, usage)
+}
+
+// WithTimeVarFlag is like WithTimeFlag, but stores the value of the flag in
+// variable.
+func (b *CobraCmdBuilder) WithTimeVarFlag(variable *time.Time, name string, layout string, value time.Time, usage string) *CobraCmdBuilder {
+	return b.WithTimeVarPFlag(variable, name, "", layout, value, usage)
+}
+
+// WithTimeVarPFlag is like WithTimeVarFlag, but accepts a shorthand letter
+// that can be used after a single dash.
+func (b *CobraCmdBuilder) WithTimeVarPFlag(variable *time.Time, name string, shorthand string, layout string, value time.Time, usage string) *CobraCmdBuilder {
+	b.cmd.Flags().VarP(newTimeValue(value, variable, layout), name, shorthand, usage)
+	return b
+}
+
+// WithTimePersistentFlag is like WithTimeFlag, but defines a persistent flag.
+func (b *CobraCmdBuilder) WithTimePersistentFlag(name string, layout string, value time.Time, usage string) *CobraCmdBuilder {
+	return b.WithTimeVarPPersistentFlag(new(time.Time), name, "", layout, value, usage)
+}
+
+// WithTimePPersistentFlag is like WithTimePFlag, but defines a persistent
+// flag.
+func (b *CobraCmdBuilder) WithTimePPersistentFlag(name string, shorthand string, layout string, value time.Time, usage string) *CobraCmdBuilder {
+	return b.WithTimeVarPPersistentFlag(new(time.Time), name, shorthand, layout, value, usage)
+}
+
+// WithTimeVarPersistentFlag is like WithTimeVarFlag, but defines a
+// persistent flag.
+func (b *CobraCmdBuilder) WithTimeVarPersistentFlag(variable *time.Time, name string, layout string, value time.Time, usage string) *CobraCmdBuilder {
+	return b.WithTimeVarPPersistentFlag(variable, name, "", layout, value, usage)
+}
+
+// WithTimeVarPPersistentFlag is like WithTimeVarPFlag, but defines a
+// persistent flag.
+func (b *CobraCmdBuilder) WithTimeVarPPersistentFlag(variable *time.Time, name string, shorthand string, layout string, value time.Time, usage string) *CobraCmdBuilder {
+	b.cmd.PersistentFlags().VarP(newTimeValue(value, variable, layout), name, shorthand, usage)
+	return b
+}
+
+// urlValue is a flag value that parses absolute URLs.
+type urlValue struct {
+	value *url.URL
+}
+
+func newURLValue(value *url.URL, p *url.URL) *urlValue {
+	if value != nil {
+		*p = *value
+	}
+	return &urlValue{value: p}
+}
+
+func (u *urlValue) Set(s string) error {
+	v, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if v.Scheme == "" || v.Host == "" {
+		return errors.New("expected a URL with a scheme and host, e.g. https://example.com")
+	}
+	*u.value = *v
+	return nil
+}
+
+func (u *urlValue) String() string {
+	return u.value.String()
+}
+
+func (u *urlValue) Type() string {
+	return "url"
+}
+
+// WithURLFlag defines a url.URL flag with specified name, default value, and
+// usage string. Values must be absolute URLs with a scheme and host, such as
+// https://example.com or ftp://example.com; any scheme is accepted, while a
+// bare example.com is rejected. The value can be retrieved with GetURL.
+func (b *CobraCmdBuilder) WithURLFlag(name string, value *url.URL, usage string) *CobraCmdBuilder {
+	return b.WithURLVarPFlag(new(url.URL), name, "", value, usage)
+}
+
+// WithURLPFlag is like WithURLFlag, but accepts a shorthand letter that can be
+// used after a single dash.
+func (b *CobraCmdBuilder) WithURLPFlag(name string, shorthand string, value *url.URL, usage string) *CobraCmdBuilder {
+	return b.WithURLVarPFlag(new(url.URL), name, shorthand, value, usage)
+}
+
+// WithURLVarFlag is like WithURLFlag, but stores the value of the flag in
+// variable.
+func (b *CobraCmdBuilder) WithURLVarFlag(variable *url.URL, name string, value *url.URL, usage string) *CobraCmdBuilder {
+	return b.WithURLVarPFlag(variable, name, "", value, usage)
+}
+
+// WithURLVarPFlag is like WithURLVarFlag, but accepts a shorthand letter that
+// can be used after a single dash.
+func (b *CobraCmdBuilder) WithURLVarPFlag(variable *url.URL, name string, shorthand string, value *url.URL, usage string) *CobraCmdBuilder {
+	b.cmd.Flags().VarP(newURLValue(value, variable), name, shorthand, usage)
+	err := b.cmd.RegisterFlagCompletionFunc(name, func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	})
+	if err != nil {
+		b.errs = append(b.errs, err)
+	}
+	return b
+}
+
+// GetURL returns the value of the URL flag called name in flags.
+func GetURL(flags *pflag.FlagSet, name string) (*url.URL, error) {
+	f := flags.Lookup(name)
+	if f == nil {
+		return nil, fmt.Errorf("flag accessed but not defined: %s", name)
+	}
+	v, ok := f.Value.(*urlValue)
+	if !ok {
+		return nil, fmt.Errorf("trying to get url value of flag of type %s", f.Value.Type())
+	}
+	u := *v.value
+	return &u, nil
+}
+
+// fileValue is a string flag value that must be the path of an existing
+// file, or - for stdin if allowed.
+type fileValue struct {
+	value      *string
+	allowStdin bool
+}
+
+func newFileValue(value string, p *string, allowStdin bool) *fileValue {
+	*p = value
+	return &fileValue{value: p, allowStdin: allowStdin}
+}
+
+func (f *fileValue) Set(s string) error {
+	if s == "-" && f.allowStdin {
+		*f.value = s
+		return nil
+	}
+	info, err := os.Stat(s)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory, expected a file", s)
+	}
+	*f.value = s
+	return nil
+}
+
+func (f *fileValue) String() string {
+	return *f.value
+}
+
+func (f *fileValue) Type() string {
+	return "file"
+}
+
+// WithExistingFileFlag defines a string flag with specified name, default
+// value, and usage string that must be the path of an existing file. Paths
+// that don't exist or are directories are rejected, and shells complete the
+// flag with filenames.
+func (b *CobraCmdBuilder) WithExistingFileFlag(name string, value string, usage string) *CobraCmdBuilder {
+	return b.withFileFlag(new(string), name, "", value, usage, false)
+}
+
+// WithExistingFilePFlag is like WithExistingFileFlag, but accepts a shorthand
+// letter that can be used after a single dash.
+func (b *CobraCmdBuilder) WithExistingFilePFlag(name string, shorthand string, value string, usage string) *CobraCmdBuilder {
+	return b.withFileFlag(new(string), name, shorthand, value, usage, false)
+}
+
+// WithExistingFileVarFlag is like WithExistingFileFlag, but stores the value
+// of the flag in variable.
+func (b *CobraCmdBuilder) WithExistingFileVarFlag(variable *string, name string, value string, usage string) *CobraCmdBuilder {
+	return b.withFileFlag(variable, name, "", value, usage, false)
+}
+
+// WithExistingFileVarPFlag is like WithExistingFileVarFlag, but accepts a
+// shorthand letter that can be used after a single dash.
+func (b *CobraCmdBuilder) WithExistingFileVarPFlag(variable *string, name string, shorthand string, value string, usage string) *CobraCmdBuilder {
+	return b.withFileFlag(variable, name, shorthand, value, usage, false)
+}
+
+// WithExistingFileOrStdinFlag is like WithExistingFileFlag, but also accepts
+// - to read from stdin.
+func (b *CobraCmdBuilder) WithExistingFileOrStdinFlag(name string, value string, usage string) *CobraCmdBuilder {
+	return b.withFileFlag(new(string), name, "", value, usage, true)
+}
+
+// WithExistingFileOrStdinVarFlag is like WithExistingFileVarFlag, but also
+// accepts - to read from stdin.
+func (b *CobraCmdBuilder) WithExistingFileOrStdinVarFlag(variable *string, name string, value string, usage string) *CobraCmdBuilder {
+	return b.withFileFlag(variable, name, "", value, usage, true)
+}
+
+func (b *CobraCmdBuilder) withFileFlag(variable *string, name string, shorthand string, value string, usage string, allowStdin bool) *CobraCmdBuilder {
+	b.cmd.Flags().VarP(newFileValue(value, variable, allowStdin), name, shorthand, usage)
+	err := b.cmd.RegisterFlagCompletionFunc(name, func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+		return nil, cobra.ShellCompDirectiveDefault
+	})
+	if err != nil {
+		b.errs = append(b.errs, err)
+	}
+	return b
+}
+
+// dirValue is a string flag value that must be the path of an existing
+// directory, or of a missing one when createIfMissing is set. Missing
+// directories are created by a pre-run hook rather than by Set, as flags are
+// also parsed to complete the command line.
+type dirValue struct {
+	value           *string
+	createIfMissing bool
+}
+
+func newDirValue(value string, p *string, createIfMissing bool) *dirValue {
+	*p = value
+	return &dirValue{value: p, createIfMissing: createIfMissing}
+}
+
+func (d *dirValue) Set(s string) error {
+	info, err := os.Stat(s)
+	switch {
+	case errors.Is(err, fs.ErrNotExist) && d.createIfMissing:
+	case errors.Is(err, fs.ErrNotExist):
+		return fmt.Errorf("%s does not exist", s)
+	case err != nil:
+		return err
+	case !info.IsDir():
+		return fmt.Errorf("%s is a file, expected a directory", s)
+	}
+	*d.value = s
+	return nil
+}
+
+func (d *dirValue) String() string {
+	return *d.value
+}
+
+func (d *dirValue) Type() string {
+	return "dir"
+}
+
+// WithDirFlag defines a string flag with specified name, default value, and
+// usage string that must be the path of an existing directory. Paths that
+// don't exist or are files are rejected with distinct errors, and shells
+// complete the flag with directories only.
+func (b *CobraCmdBuilder) WithDirFlag(name string, value string, usage string) *CobraCmdBuilder {
+	return b.withDirFlag(new(string), name, "", value, usage, false)
+}
+
+// WithDirPFlag is like WithDirFlag, but accepts a shorthand letter that can
+// be used after a single dash.
+func (b *CobraCmdBuilder) WithDirPFlag(name string, shorthand string, value string, usage string) *CobraCmdBuilder {
+	return b.withDirFlag(new(string), name, shorthand, value, usage, false)
+}
+
+// WithDirVarFlag is like WithDirFlag, but stores the value of the flag in
+// variable.
+func (b *CobraCmdBuilder) WithDirVarFlag(variable *string, name string, value string, usage string) *CobraCmdBuilder {
+	return b.withDirFlag(variable, name, "", value, usage, false)
+}
+
+// WithDirVarPFlag is like WithDirVarFlag, but accepts a shorthand letter that
+// can be used after a single dash.
+func (b *CobraCmdBuilder) WithDirVarPFlag(variable *string, name string, shorthand string, value string, usage string) *CobraCmdBuilder {
+	return b.withDirFlag(variable, name, shorthand, value, usage, false)
+}
+
+// WithCreateDirFlag is like WithDirFlag, but creates the directory, along
+// with any missing parents, if it doesn't exist.
+func (b *CobraCmdBuilder) WithCreateDirFlag(name string, value string, usage string) *CobraCmdBuilder {
+	return b.withDirFlag(new(string), name, "", value, usage, true)
+}
+
+// WithCreateDirVarFlag is like WithDirVarFlag, but creates the directory,
+// along with any missing parents, if it doesn't exist.
+func (b *CobraCmdBuilder) WithCreateDirVarFlag(variable *string, name string, value string, usage string) *CobraCmdBuilder {
+	return b.withDirFlag(variable, name, "", value, usage, true)
+}
+
+func (b *CobraCmdBuilder) withDirFlag(variable *string, name string, shorthand string, value string, usage string, createIfMissing bool) *CobraCmdBuilder {
+	b.cmd.Flags().VarP(newDirValue(value, variable, createIfMissing), name, shorthand, usage)
+	err := b.cmd.RegisterFlagCompletionFunc(name, func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+		return nil, cobra.ShellCompDirectiveFilterDirs
+	})
+	if err != nil {
+		b.errs = append(b.errs, err)
+	}
+	if createIfMissing {
+		b.onBuild = append(b.onBuild, func() {
+			b.beforePreRun(func(cmd *cobra.Command, args []string) error {
+				if !cmd.Flags().Changed(name) {
+					return nil
+				}
+				return os.MkdirAll(*variable, 0o755)
+			})
+		})
+	}
+	return b
+}
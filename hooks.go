@@ -0,0 +1,60 @@
+package boa
+
+import "github.com/spf13/cobra"
+
+// beforePersistentPreRun runs f ahead of whichever persistent pre-run
+// function is already set on the command.
+func (b *CobraCmdBuilder) beforePersistentPreRun(f runFunc) {
+	b.cmd.PersistentPreRunE = runBefore(f, b.cmd.PersistentPreRunE, b.cmd.PersistentPreRun)
+}
+
+// beforePreRun runs f ahead of whichever pre-run function is already set on
+// the command.
+func (b *CobraCmdBuilder) beforePreRun(f runFunc) {
+	b.cmd.PreRunE = runBefore(f, b.cmd.PreRunE, b.cmd.PreRun)
+}
+
+// runBefore returns a function that runs f and then, if f succeeds, prevE or
+// prev, whichever is set.
+func runBefore(f runFunc, prevE runFunc, prev func(cmd *cobra.Command, args []string)) runFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		if err := f(cmd, args); err != nil {
+			return err
+		}
+		if prevE != nil {
+			return prevE(cmd, args)
+		}
+		if prev != nil {
+			prev(cmd, args)
+		}
+		return nil
+	}
+}
+
+// runFunc is the signature of cobra's RunE functions.
+type runFunc func(cmd *cobra.Command, args []string) error
+
+// wrapRun replaces the run function of a runnable cmd with the one returned
+// by wrap, which is given the existing run function to call.
+func wrapRun(cmd *cobra.Command, wrap func(next runFunc) runFunc) {
+	run, runE := cmd.Run, cmd.RunE
+	if run == nil && runE == nil {
+		return
+	}
+	next := runE
+	if next == nil {
+		next = func(cmd *cobra.Command, args []string) error {
+			run(cmd, args)
+			return nil
+		}
+	}
+	cmd.Run, cmd.RunE = nil, wrap(next)
+}
+
+// walk calls f for cmd and every one of its descendants.
+func walk(cmd *cobra.Command, f func(*cobra.Command)) {
+	f(cmd)
+	for _, sub := range cmd.Commands() {
+		walk(sub, f)
+	}
+}
@@ -0,0 +1,97 @@
+package boa
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// interpolationRef matches a {{key}} reference, along with the backslash
+// that escapes it, if any. Template actions such as {{.Home}} aren't matched,
+// so that they're left for WithConfigTemplating.
+var interpolationRef = regexp.MustCompile(`\\?\{\{\s*([^{}\s.][^{}\s]*)\s*\}\}`)
+
+// WithKeyInterpolation makes string values that reference other config keys
+// resolve those references once the configuration has been read, e.g.
+//
+//	host: example.com
+//	port: 8443
+//	base_url: https://{{host}}:{{port}}
+//
+// References are resolved recursively, whichever source sets the referenced
+// key. Reading fails if a reference is to a key that isn't set, or if keys
+// reference each other in a cycle. A reference can be escaped with a
+// backslash, as in \{{host}}, to keep it literally.
+//
+// Resolved values are stored as config file values, so env vars and flags
+// keep their precedence over them but aren't interpolated themselves.
+func (b *ViperCfgBuilder) WithKeyInterpolation() *ViperCfgBuilder {
+	b.interpolation = true
+	return b
+}
+
+// interpolateKeys resolves the key references of every string value.
+func (b *ViperCfgBuilder) interpolateKeys() error {
+	if !b.interpolation {
+		return nil
+	}
+	resolved := map[string]string{}
+	keys := b.cfg.AllKeys()
+	sort.Strings(keys)
+	for _, k := range keys {
+		v, ok := b.cfg.Get(k).(string)
+		if !ok || !strings.Contains(v, "{{") {
+			continue
+		}
+		r, err := b.resolveKey(k, resolved, nil)
+		if err != nil {
+			return err
+		}
+		if r != v {
+			if err := b.cfg.MergeConfigMap(nestedMap(k, r)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolveKey returns the value of key with its references resolved. path
+// holds the keys being resolved that led to key, to detect cycles.
+func (b *ViperCfgBuilder) resolveKey(key string, resolved map[string]string, path []string) (string, error) {
+	if v, ok := resolved[key]; ok {
+		return v, nil
+	}
+	for i, k := range path {
+		if k == key {
+			cycle := append(path[i:], key)
+			return "", fmt.Errorf("config key interpolation cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	if !b.cfg.IsSet(key) {
+		return "", fmt.Errorf("config key %q references undefined key %q", path[len(path)-1], key)
+	}
+	v, ok := b.cfg.Get(key).(string)
+	if !ok {
+		return fmt.Sprint(b.cfg.Get(key)), nil
+	}
+	path = append(path, key)
+	var err error
+	r := interpolationRef.ReplaceAllStringFunc(v, func(ref string) string {
+		if err != nil {
+			return ref
+		}
+		if strings.HasPrefix(ref, `\`) {
+			return ref[1:]
+		}
+		var s string
+		s, err = b.resolveKey(strings.ToLower(interpolationRef.FindStringSubmatch(ref)[1]), resolved, path)
+		return s
+	})
+	if err != nil {
+		return "", err
+	}
+	resolved[key] = r
+	return r, nil
+}
@@ -0,0 +1,60 @@
+package boa
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	// OutputFlagName is the name of the flag registered by
+	// WithJSONLinesOutput to choose the output format.
+	OutputFlagName = "output"
+	// JSONLinesFormat is the output format that writes one JSON object per
+	// line.
+	JSONLinesFormat = "jsonl"
+)
+
+// WithJSONLinesOutput registers an --output/-o flag that chooses between
+// "text", the default, and "jsonl" output. Run functions check the format
+// with IsJSONLinesOutput and stream their records with a JSONLinesWriter, so
+// large result sets can be piped into tools such as jq without buffering
+// them all.
+func (b *CobraCmdBuilder) WithJSONLinesOutput() *CobraCmdBuilder {
+	format := b.cmd.Flags().StringP(OutputFlagName, "o", "text", "output format, text or "+JSONLinesFormat)
+	b.beforePreRun(func(cmd *cobra.Command, args []string) error {
+		switch *format {
+		case "text", JSONLinesFormat:
+			return nil
+		}
+		return fmt.Errorf("invalid output format %q, expected text or %s", *format, JSONLinesFormat)
+	})
+	return b
+}
+
+// IsJSONLinesOutput returns whether cmd's --output flag asks for JSON Lines.
+func IsJSONLinesOutput(cmd *cobra.Command) bool {
+	format, _ := cmd.Flags().GetString(OutputFlagName)
+	return format == JSONLinesFormat
+}
+
+// JSONLinesWriter writes records as JSON Lines, each record a standalone JSON
+// value on its own line, as soon as it's written.
+type JSONLinesWriter struct {
+	enc *json.Encoder
+}
+
+// NewJSONLinesWriter returns a JSONLinesWriter writing to w, typically
+// cmd.OutOrStdout().
+func NewJSONLinesWriter(w io.Writer) *JSONLinesWriter {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &JSONLinesWriter{enc: enc}
+}
+
+// Write writes record as a single line of JSON.
+func (w *JSONLinesWriter) Write(record any) error {
+	return w.enc.Encode(record)
+}
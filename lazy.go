@@ -0,0 +1,89 @@
+package boa
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+// lazyCommands maps the placeholders of lazy subcommands to the functions
+// that replace them with the real commands.
+var lazyCommands sync.Map
+
+// WithLazySubCommand adds a subcommand called name whose construction is
+// deferred until it's needed, for large CLIs where building every subcommand
+// up front, each wiring up its own clients and config, slows down startup.
+// factory is only called when the subcommand, or one of its own subcommands,
+// is about to be executed, completed or has its help requested, and short is
+// used to list it in the help text until then.
+//
+// cobra resolves the command to execute before running any of its functions,
+// so it first resolves a placeholder that stands in for the subcommand. The
+// placeholder replaces itself with the real command when its args are
+// validated, before any persistent pre-run functions run, and then executes
+// the root command again with the same command line so that cobra resolves
+// the real command, parses its flags and runs its functions. Functions
+// registered with cobra.OnInitialize or cobra.OnFinalize run for both
+// executions; calling LoadLazySubCommands before Execute avoids that, and is
+// needed for shell completions of the subcommand's flags and args.
+func (b *CobraCmdBuilder) WithLazySubCommand(name string, short string, factory func() *cobra.Command) *CobraCmdBuilder {
+	var placeholder, real, root *cobra.Command
+	var line []string
+	materialize := func() *cobra.Command {
+		if real == nil {
+			real = factory()
+			parent := placeholder.Parent()
+			parent.RemoveCommand(placeholder)
+			parent.AddCommand(real)
+			lazyCommands.Delete(placeholder)
+		}
+		return real
+	}
+	placeholder = NewCobraCmd(name).
+		WithShortDescription(short).
+		DisableFlagParsing().
+		WithArgs(func(cmd *cobra.Command, args []string) error {
+			// Loading the real command detaches the placeholder, so the
+			// persistent functions of its former parents don't run for it.
+			root, line = cmd.Root(), append(strings.Fields(cmd.CommandPath())[1:], args...)
+			materialize()
+			return nil
+		}).
+		WithRunEFunc(func(cmd *cobra.Command, args []string) error {
+			root.SetArgs(line)
+			return root.Execute()
+		}).
+		Build()
+	// The executed root reports errors itself.
+	placeholder.SilenceErrors, placeholder.SilenceUsage = true, true
+	placeholder.SetHelpFunc(func(_ *cobra.Command, args []string) {
+		cmd := materialize()
+		cmd.HelpFunc()(cmd, args)
+	})
+	lazyCommands.Store(placeholder, materialize)
+	b.cmd.AddCommand(placeholder)
+	return b
+}
+
+// LoadLazySubCommands replaces the placeholders of the lazy subcommands of
+// root that args select with the real commands, so that cobra resolves and
+// executes those directly. It may be called with the args root is about to
+// be executed with, such as os.Args[1:], before calling Execute. Requests for
+// help or shell completions of a lazy subcommand load it too.
+func LoadLazySubCommands(root *cobra.Command, args []string) {
+	if len(args) > 0 {
+		switch args[0] {
+		case "help", cobra.ShellCompRequestCmd, cobra.ShellCompNoDescRequestCmd:
+			args = args[1:]
+		}
+	}
+	for {
+		cmd, _, _ := root.Find(args)
+		materialize, ok := lazyCommands.Load(cmd)
+		if !ok {
+			return
+		}
+		materialize.(func() *cobra.Command)()
+	}
+}
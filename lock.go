@@ -0,0 +1,55 @@
+package boa
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrLockTimeout is returned when a config file's lock can't be acquired
+// within the timeout given to WithLockFile.
+var ErrLockTimeout = errors.New("timed out waiting for config lock")
+
+// lockRetryInterval is how often acquiring a held lock is retried.
+const lockRetryInterval = 10 * time.Millisecond
+
+// WithLockFile makes writes to a config file hold an exclusive lock on a
+// "<file>.lock" file alongside it, so that concurrent invocations, such as
+// parallel `config set` commands, write one after another rather than
+// corrupting the file. A write fails with ErrLockTimeout if the lock isn't
+// acquired within timeout.
+func (b *ViperCfgBuilder) WithLockFile(timeout time.Duration) *ViperCfgBuilder {
+	b.lockTimeout = timeout
+	b.lockWrites = true
+	return b
+}
+
+// writeLocked runs write while holding the lock of the config file at path,
+// if writes are locked.
+func (b *ViperCfgBuilder) writeLocked(path string, write func() error) error {
+	if !b.lockWrites {
+		return write()
+	}
+	unlock, err := lockFile(path+".lock", b.lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return write()
+}
+
+// lockFile acquires an exclusive lock on the file at path, retrying until
+// timeout, and returns a function that releases it.
+func lockFile(path string, timeout time.Duration) (func(), error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		unlock, ok, err := tryLockFile(path)
+		if err != nil || ok {
+			return unlock, err
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%w %s", ErrLockTimeout, path)
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
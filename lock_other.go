@@ -0,0 +1,24 @@
+//go:build !unix
+
+package boa
+
+import (
+	"errors"
+	"os"
+)
+
+// tryLockFile tries to acquire a lock by exclusively creating the file at
+// path, without blocking. The file is removed to release the lock.
+func tryLockFile(path string) (func(), bool, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0o600)
+	if errors.Is(err, os.ErrExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return func() {
+		f.Close()
+		os.Remove(path)
+	}, true, nil
+}
@@ -0,0 +1,44 @@
+package boa
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithLockFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			b := NewViperCfg().WithLockFile(5 * time.Second)
+			b.Build().Set("writer", i)
+			b.Build().Set("data", strings.Repeat(fmt.Sprint(i), 10000))
+			_, err := b.WriteConfigAs(path)
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	cfg := NewViperCfg().WithConfigFiles(path).ReadInConfig().Build()
+	writer := cfg.GetInt("writer")
+	assert.Equal(t, strings.Repeat(fmt.Sprint(writer), 10000), cfg.GetString("data"))
+
+	unlock, err := lockFile(path+".lock", time.Second)
+	assert.NoError(t, err)
+	_, err = NewViperCfg().WithLockFile(50 * time.Millisecond).WriteConfigAs(path)
+	assert.ErrorIs(t, err, ErrLockTimeout)
+	unlock()
+	_, err = NewViperCfg().WithLockFile(50 * time.Millisecond).WriteConfigAs(path)
+	assert.NoError(t, err)
+
+	_, err = NewViperCfg().WithLockFile(time.Second).SafeWriteConfigAs(path)
+	assert.Error(t, err)
+}
@@ -0,0 +1,139 @@
+package boa
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+)
+
+// WithMergeConfigFiles merges each of files that exists into the
+// configuration, in order, so that values in later files override those in
+// earlier files. Nested maps are merged key by key rather than replaced, so
+// an override file only needs the keys it changes. This supports shipping a
+// baked-in default config alongside an optional user override file.
+//
+// Reload merges the files again, on top of the config file read before them
+// if there is one, so files created since are picked up. Nothing is done if
+// none of files exist.
+//
+// If an error is encountered, logs fatal
+func (b *ViperCfgBuilder) WithMergeConfigFiles(files ...string) *ViperCfgBuilder {
+	if _, err := b.TryWithMergeConfigFiles(files...); err != nil {
+		log.Fatalf("Error merging config: %v", err)
+	}
+	return b
+}
+
+// TryWithMergeConfigFiles is like WithMergeConfigFiles, but returns the error
+// rather than logging fatal.
+func (b *ViperCfgBuilder) TryWithMergeConfigFiles(files ...string) (*ViperCfgBuilder, error) {
+	if b.mergeFiles == nil {
+		for i := len(b.configFiles) - 1; i >= 0; i-- {
+			b.mergeFiles = append(b.mergeFiles, b.configFiles[i])
+		}
+		if b.configFile != "" {
+			b.mergeFiles = append(b.mergeFiles, b.configFile)
+		}
+	}
+	b.mergeFiles = append(b.mergeFiles, files...)
+	var merged []string
+	for _, f := range files {
+		if exists(f) {
+			merged = append([]string{f}, merged...)
+		}
+	}
+	if len(merged) == 0 {
+		return b, nil
+	}
+	data, err := b.readTimed(func(ctx context.Context) ([][]byte, error) {
+		return readFilesContext(ctx, merged)
+	})
+	if err != nil {
+		return b, err
+	}
+	if err := b.mergeSources(fileSources(merged, data)); err != nil {
+		return b, err
+	}
+	b.configFile, b.configFiles = "", append(merged, b.configFiles...)
+	return b, b.afterRead()
+}
+
+// readMergeFiles reads the files given to WithMergeConfigFiles that exist
+// again, doing nothing if none do.
+func (b *ViperCfgBuilder) readMergeFiles() error {
+	var files []string
+	for _, f := range b.mergeFiles {
+		if exists(f) {
+			files = append([]string{f}, files...)
+		}
+	}
+	if len(files) == 0 {
+		return nil
+	}
+	data, err := b.readTimed(func(ctx context.Context) ([][]byte, error) {
+		return readFilesContext(ctx, files)
+	})
+	if err != nil {
+		return err
+	}
+	sources := fileSources(files, data)
+	if err := b.checkSources(sources); err != nil {
+		return err
+	}
+	b.sources, b.rebuildable = sources, true
+	b.configFile, b.configFiles = "", files
+	return b.afterRead()
+}
+
+// MergeConfig merges the configuration read from in, in the format set by
+// WithConfigType, into the configuration, as with WithMergeConfigFiles.
+//
+// If an error is encountered, logs fatal
+func (b *ViperCfgBuilder) MergeConfig(in io.Reader) *ViperCfgBuilder {
+	if _, err := b.TryMergeConfig(in); err != nil {
+		log.Fatalf("Error merging config: %v", err)
+	}
+	return b
+}
+
+// TryMergeConfig is like MergeConfig, but returns the error rather than
+// logging fatal.
+func (b *ViperCfgBuilder) TryMergeConfig(in io.Reader) (*ViperCfgBuilder, error) {
+	data, err := b.readTimed(func(ctx context.Context) ([][]byte, error) {
+		data, err := readAllContext(ctx, in)
+		return [][]byte{data}, err
+	})
+	if err != nil {
+		return b, err
+	}
+	if err := b.mergeSources([]configSource{{data: data[0]}}); err != nil {
+		return b, err
+	}
+	return b, b.afterRead()
+}
+
+// mergeSources adds sources on top of the sources read before them, once
+// they've been checked, to be merged when the config is next processed.
+func (b *ViperCfgBuilder) mergeSources(sources []configSource) error {
+	if err := b.checkSources(sources); err != nil {
+		return err
+	}
+	if !b.rebuildable {
+		// The config the viper.Viper had when the builder was given it
+		// can't be rebuilt, so the sources are merged on top of it.
+		for _, src := range sources {
+			if src.file != "" {
+				b.cfg.SetConfigFile(src.file)
+			}
+			if err := b.cfg.MergeConfig(bytes.NewReader(src.data)); err != nil {
+				return err
+			}
+			if err := b.mergeDocuments(b.cfg, src); err != nil {
+				return err
+			}
+		}
+	}
+	b.sources = append(b.sources, sources...)
+	return nil
+}
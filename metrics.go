@@ -0,0 +1,72 @@
+package boa
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/cobra"
+)
+
+// WithCommandMetrics instruments the command and all of its subcommands with
+// Prometheus metrics registered with reg, all labelled by command path:
+//
+//   - boa_command_invocations_total counts how many times a command ran
+//   - boa_command_errors_total counts how many times a command failed
+//   - boa_command_duration_seconds observes how long a command took to run
+//
+// This is meant for CLIs that run as long-lived workers invoking their own
+// subcommands. The run functions of the command and its subcommands are
+// wrapped when it's built, so subcommands should be added before then.
+// Registering fails, and panics, if reg already has different collectors
+// with the same names.
+func (b *CobraCmdBuilder) WithCommandMetrics(reg prometheus.Registerer) *CobraCmdBuilder {
+	invocations := registerCollector(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "boa_command_invocations_total",
+		Help: "Number of times a command was run.",
+	}, []string{"command"}))
+	failures := registerCollector(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "boa_command_errors_total",
+		Help: "Number of times a command returned an error.",
+	}, []string{"command"}))
+	duration := registerCollector(reg, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "boa_command_duration_seconds",
+		Help:    "How long a command took to run.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"command"}))
+
+	b.onBuild = append(b.onBuild, func() {
+		walk(b.cmd, func(cmd *cobra.Command) {
+			wrapRun(cmd, func(next runFunc) runFunc {
+				return func(cmd *cobra.Command, args []string) error {
+					path := cmd.CommandPath()
+					start := time.Now()
+					err := next(cmd, args)
+					duration.WithLabelValues(path).Observe(time.Since(start).Seconds())
+					invocations.WithLabelValues(path).Inc()
+					if err != nil {
+						failures.WithLabelValues(path).Inc()
+					}
+					return err
+				}
+			})
+		})
+	})
+	return b
+}
+
+// registerCollector registers c with reg, returning the collector that was
+// already registered in its place if there is one.
+func registerCollector[T prometheus.Collector](reg prometheus.Registerer, c T) T {
+	err := reg.Register(c)
+	if err == nil {
+		return c
+	}
+	var are prometheus.AlreadyRegisteredError
+	if errors.As(err, &are) {
+		if existing, ok := are.ExistingCollector.(T); ok {
+			return existing
+		}
+	}
+	panic(err)
+}
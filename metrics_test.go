@@ -0,0 +1,48 @@
+package boa
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithCommandMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	child := NewCobraCmd("child").
+		WithRunEFunc(func(*cobra.Command, []string) error { return errors.New("failed") }).
+		SilenceErrors().
+		SilenceUsage().
+		Build()
+	cmd := NewCobraCmd("root").
+		WithCommandMetrics(reg).
+		WithSubCommands(child).
+		WithNoOp().
+		Build()
+
+	cmd.SetArgs([]string{})
+	assert.NoError(t, cmd.Execute())
+	cmd.SetArgs([]string{"child"})
+	assert.Error(t, cmd.Execute())
+	cmd.SetArgs([]string{"child"})
+	assert.Error(t, cmd.Execute())
+
+	expected := `
+# HELP boa_command_errors_total Number of times a command returned an error.
+# TYPE boa_command_errors_total counter
+boa_command_errors_total{command="root child"} 2
+# HELP boa_command_invocations_total Number of times a command was run.
+# TYPE boa_command_invocations_total counter
+boa_command_invocations_total{command="root"} 1
+boa_command_invocations_total{command="root child"} 2
+`
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expected),
+		"boa_command_invocations_total", "boa_command_errors_total"))
+	count, err := testutil.GatherAndCount(reg, "boa_command_duration_seconds")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
@@ -0,0 +1,44 @@
+package boa
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// mergeDocuments merges every document after the first of src, if it's a
+// multi-document YAML config, into v, which is expected to have merged the
+// first already.
+func (b *ViperCfgBuilder) mergeDocuments(v *viper.Viper, src configSource) error {
+	if !b.multiDocument || !b.isYAML(src.file) {
+		return nil
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(src.data))
+	for i := 0; ; i++ {
+		var doc map[string]any
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("decoding config document %d: %w", i+1, err)
+		}
+		if i == 0 || doc == nil {
+			continue
+		}
+		if err := v.MergeConfigMap(doc); err != nil {
+			return err
+		}
+	}
+}
+
+// isYAML returns whether the config read from file, or from a reader if file
+// is empty, is YAML.
+func (b *ViperCfgBuilder) isYAML(file string) bool {
+	ext := b.sourceType(file)
+	return ext == "yaml" || ext == "yml"
+}
@@ -0,0 +1,95 @@
+package boa
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// WithOptionValidator is used to check the value of an option beyond its
+// membership in ValidArgs, e.g. that a region is a known region. Options are
+// given values as name=value, and validate is called with the value of each
+// provided arg naming the option, or one of its aliases, whether given a value
+// or not. The command fails with an error naming the option when validate
+// returns an error.
+//
+// The command's args validator is wrapped, so this should be called after
+// setting it. It's given the option's name in place of name=value, so that
+// validators such as cobra.OnlyValidArgs, used by WithMinValidArgs and
+// WithMaxValidArgs, accept the option with a value.
+func (b *BoaCmdBuilder) WithOptionValidator(name string, validate func(value string) error) *BoaCmdBuilder {
+	prev := b.cmd.Args
+	b.cmd.Args = func(cmd *cobra.Command, args []string) error {
+		names := b.cmd.optionAliases(name)
+		validated := make([]string, len(args))
+		for i, arg := range args {
+			validated[i] = arg
+			argName, value, _ := strings.Cut(arg, "=")
+			if !contains(names, argName) {
+				continue
+			}
+			if err := validate(value); err != nil {
+				return fmt.Errorf("invalid value %q for option %q: %w", value, name, err)
+			}
+			validated[i] = argName
+		}
+		if prev != nil {
+			return prev(cmd, validated)
+		}
+		return nil
+	}
+	return b
+}
+
+// WithExactlyOneOption is used when options represent modes, making the
+// command fail unless exactly one of the named options, or one of their
+// aliases, is provided. Options given as name=value count as provided.
+//
+// The command's args validator is wrapped, so this should be called after
+// setting it.
+func (b *BoaCmdBuilder) WithExactlyOneOption(names ...string) *BoaCmdBuilder {
+	prev := b.cmd.Args
+	b.cmd.Args = func(cmd *cobra.Command, args []string) error {
+		var given []string
+		for _, name := range names {
+			aliases := b.cmd.optionAliases(name)
+		args:
+			for _, arg := range args {
+				argName, _, _ := strings.Cut(arg, "=")
+				for _, alias := range aliases {
+					if argName == alias {
+						given = append(given, name)
+						break args
+					}
+				}
+			}
+		}
+		if len(given) != 1 {
+			err := fmt.Sprintf("exactly one of the options %v is required", names)
+			if len(given) > 1 {
+				err += fmt.Sprintf(", got %v", given)
+			}
+			return errors.New(err)
+		}
+		if prev != nil {
+			return prev(cmd, args)
+		}
+		return nil
+	}
+	return b
+}
+
+// optionAliases returns the names of the option that name is one of, or just
+// name if no option has it.
+func (c Command) optionAliases(name string) []string {
+	for _, opt := range c.Opts {
+		for _, n := range opt.Names() {
+			if n == name {
+				return opt.Names()
+			}
+		}
+	}
+	return []string{name}
+}
@@ -0,0 +1,67 @@
+package boa
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// OverrideFlagName is the name of the flag registered by WithOverrideFlag.
+const OverrideFlagName = "set"
+
+// WithOverrideFlag registers a persistent --set flag on cmd that overrides
+// any config key from the command line, e.g. --set database.pool=20. The
+// flag may be repeated or given comma separated key=value pairs. Overrides
+// are applied before cmd, or any of its subcommands, runs and take precedence
+// over every other source of configuration.
+func (b *ViperCfgBuilder) WithOverrideFlag(cmd *cobra.Command) *ViperCfgBuilder {
+	overrides := cmd.PersistentFlags().StringToString(OverrideFlagName, nil,
+		"override a config value, e.g. --set key=value")
+	if b.overrides == nil {
+		b.overrides = map[string]any{}
+	}
+	ToCobraCmdBuilder(cmd).beforePersistentPreRun(func(*cobra.Command, []string) error {
+		for k, v := range *overrides {
+			b.setOverride(k, v)
+		}
+		return nil
+	})
+	return b
+}
+
+// WithChangedFlags sets the value of every flag in fs that was changed on the
+// command line as an override of the config key of the same name. This seeds
+// viper with explicit CLI input when the flags were parsed before viper was
+// built, without binding the flags' defaults.
+func (b *ViperCfgBuilder) WithChangedFlags(fs *pflag.FlagSet) *ViperCfgBuilder {
+	return b.WithChangedFlagsAs(fs, nil)
+}
+
+// WithChangedFlagsAs is like WithChangedFlags, but keys maps flag names to
+// the config keys to set. Flags that aren't in keys set the key of the same
+// name.
+func (b *ViperCfgBuilder) WithChangedFlagsAs(fs *pflag.FlagSet, keys map[string]string) *ViperCfgBuilder {
+	if b.overrides == nil {
+		b.overrides = map[string]any{}
+	}
+	fs.Visit(func(f *pflag.Flag) {
+		key, ok := keys[f.Name]
+		if !ok {
+			key = f.Name
+		}
+		var value any = f.Value.String()
+		if s, ok := f.Value.(pflag.SliceValue); ok {
+			value = s.GetSlice()
+		}
+		b.setOverride(key, value)
+	})
+	return b
+}
+
+// setOverride sets key to value with the highest precedence.
+func (b *ViperCfgBuilder) setOverride(key string, value any) {
+	key = strings.ToLower(key)
+	b.overrides[key] = value
+	b.cfg.Set(key, value)
+}
@@ -0,0 +1,90 @@
+package boa
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// runPager pipes r through the pager command line argv to w. It is a
+// variable so that tests can capture what would be paged.
+var runPager = func(argv []string, r io.Reader, w io.Writer) error {
+	c := exec.Command(argv[0], argv[1:]...)
+	c.Stdin = r
+	c.Stdout = w
+	c.Stderr = os.Stderr
+	return c.Run()
+}
+
+// WithPager is used to page long help text, like git does. When the
+// command's output is a terminal, help is piped through $PAGER, falling back
+// to less or more, rather than written directly. Help is written directly
+// when the output isn't a terminal or no pager is found.
+//
+// The help function the command has when it's built is the one paged, so a
+// custom help function or template may be set before or after this is
+// called, but help extended once the command is built, such as by
+// WithEnvHelp, isn't paged. less is run with -R, unless $LESS sets its
+// options, so that colored help is shown in color.
+func (b *CobraCmdBuilder) WithPager() *CobraCmdBuilder {
+	b.onBuild = append(b.onBuild, func() {
+		help := b.cmd.HelpFunc()
+		b.cmd.SetHelpFunc(func(cmd *cobra.Command, args []string) {
+			out := cmd.OutOrStdout()
+			pager := pagerCommand()
+			if _, tty := terminalWidth(out); !tty || pager == nil {
+				help(cmd, args)
+				return
+			}
+			buf := new(bytes.Buffer)
+			restore := setOutTemporarily(cmd, buf)
+			help(cmd, args)
+			restore()
+			if err := runPager(pager, bytes.NewReader(buf.Bytes()), out); err != nil {
+				out.Write(buf.Bytes())
+			}
+		})
+	})
+	return b
+}
+
+// setOutTemporarily sets the output of cmd to w, returning a function that
+// sets it back to what it was, which may be inherited from its parent rather
+// than set on cmd.
+func setOutTemporarily(cmd *cobra.Command, w io.Writer) func() {
+	out := cmd.OutOrStdout()
+	cmd.SetOut(nil)
+	inherited := cmd.OutOrStdout()
+	cmd.SetOut(w)
+	return func() {
+		if reflect.TypeOf(out).Comparable() && out == inherited {
+			cmd.SetOut(nil)
+			return
+		}
+		cmd.SetOut(out)
+	}
+}
+
+// pagerCommand returns the command line of the pager to use, or nil if there
+// isn't one.
+func pagerCommand() []string {
+	if pager := strings.Fields(os.Getenv("PAGER")); len(pager) > 0 {
+		return pager
+	}
+	for _, pager := range []string{"less", "more"} {
+		path, err := exec.LookPath(pager)
+		if err != nil {
+			continue
+		}
+		if _, ok := os.LookupEnv("LESS"); pager == "less" && !ok {
+			return []string{path, "-R"}
+		}
+		return []string{path}
+	}
+	return nil
+}
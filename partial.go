@@ -0,0 +1,107 @@
+package boa
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// SectionError describes a top-level config section that was skipped by a
+// partial read because it couldn't be parsed.
+type SectionError struct {
+	Section string
+	Err     error
+}
+
+func (e SectionError) Error() string {
+	return fmt.Sprintf("invalid config section %q: %v", e.Section, e.Err)
+}
+
+func (e SectionError) Unwrap() error {
+	return e.Err
+}
+
+// WithPartialRead makes reading a YAML config best-effort. If the config
+// can't be parsed, each top-level section is parsed on its own instead and
+// only the valid sections are loaded. The sections that were skipped are
+// logged and returned by SectionErrors.
+func (b *ViperCfgBuilder) WithPartialRead() *ViperCfgBuilder {
+	b.partialRead = true
+	return b
+}
+
+// SectionErrors returns the config sections skipped by the last partial read.
+func (b *ViperCfgBuilder) SectionErrors() []SectionError {
+	return b.sectionErrors
+}
+
+// readPartial returns the valid top-level sections of the config data of
+// type ext when the config couldn't be parsed as a whole. Any other read
+// error is returned as is.
+func (b *ViperCfgBuilder) readPartial(data []byte, ext string, err error) ([]byte, error) {
+	var parseErr viper.ConfigParseError
+	if !b.partialRead || !errors.As(err, &parseErr) || (ext != "yaml" && ext != "yml") {
+		return nil, err
+	}
+	b.sectionErrors = nil
+	var valid bytes.Buffer
+	for _, s := range splitSections(data) {
+		var m map[string]any
+		if err := yaml.Unmarshal(s.data, &m); err != nil {
+			sectionErr := SectionError{Section: s.name, Err: err}
+			log.Printf("Skipping %v", sectionErr)
+			b.sectionErrors = append(b.sectionErrors, sectionErr)
+			continue
+		}
+		valid.Write(s.data)
+	}
+	return valid.Bytes(), nil
+}
+
+type section struct {
+	name string
+	data []byte
+}
+
+// splitSections splits YAML data into its top-level sections, each starting
+// at an unindented key. Anything before the first key, such as comments, is
+// kept with the first section.
+func splitSections(data []byte) []section {
+	var sections []section
+	var cur *section
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		if isSectionStart(line) {
+			name, _, _ := strings.Cut(string(line), ":")
+			var prev []byte
+			if cur != nil && cur.name == "" {
+				prev = cur.data
+				sections = sections[:len(sections)-1]
+			}
+			sections = append(sections, section{name: strings.TrimSpace(name), data: prev})
+			cur = &sections[len(sections)-1]
+		} else if cur == nil {
+			sections = append(sections, section{})
+			cur = &sections[len(sections)-1]
+		}
+		cur.data = append(cur.data, line...)
+	}
+	return sections
+}
+
+// isSectionStart returns whether line starts a top-level YAML section.
+func isSectionStart(line []byte) bool {
+	s := strings.TrimRight(string(line), "\r\n")
+	if s == "" || s == "---" || s == "..." {
+		return false
+	}
+	switch s[0] {
+	case ' ', '\t', '#', '-':
+		return false
+	}
+	return true
+}
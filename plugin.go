@@ -0,0 +1,97 @@
+package boa
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// PluginGroupID is the group ID given to subcommands registered by
+// WithPluginPrefix so that they're listed in their own help section.
+const PluginGroupID = "plugins"
+
+// WithPluginPrefix discovers executables on PATH named "<prefix>-<name>" and
+// registers each as a subcommand called name that execs the executable,
+// forwarding any args. Plugins are listed under their own section in the
+// help output.
+//
+// Following kubectl's plugin model, the first matching executable on PATH
+// wins, and a plugin never replaces a subcommand that already exists, so
+// this should be called after adding the command's subcommands.
+func (b *CobraCmdBuilder) WithPluginPrefix(prefix string) *CobraCmdBuilder {
+	plugins := findPlugins(prefix)
+	if len(plugins) == 0 {
+		return b
+	}
+	if !b.cmd.ContainsGroup(PluginGroupID) {
+		b.cmd.AddGroup(&cobra.Group{ID: PluginGroupID, Title: "Plugin Commands:"})
+	}
+	for _, p := range plugins {
+		if sub, _, err := b.cmd.Find([]string{p.name}); err == nil && sub != b.cmd {
+			continue
+		}
+		b.cmd.AddCommand(newPluginCmd(p.name, p.path))
+	}
+	return b
+}
+
+type plugin struct {
+	name string
+	path string
+}
+
+// findPlugins returns the executables on PATH prefixed with prefix, in PATH
+// order and without duplicate names.
+func findPlugins(prefix string) []plugin {
+	var plugins []plugin
+	seen := map[string]bool{}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			name, ok := strings.CutPrefix(e.Name(), prefix+"-")
+			if runtime.GOOS == "windows" {
+				name = strings.TrimSuffix(name, filepath.Ext(name))
+			}
+			if !ok || name == "" || seen[name] {
+				continue
+			}
+			path := filepath.Join(dir, e.Name())
+			if !isExecutable(path) {
+				continue
+			}
+			seen[name] = true
+			plugins = append(plugins, plugin{name, path})
+		}
+	}
+	return plugins
+}
+
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return false
+	}
+	return runtime.GOOS == "windows" || info.Mode()&0111 != 0
+}
+
+func newPluginCmd(name string, path string) *cobra.Command {
+	return NewCobraCmd(name).
+		WithShortDescription("Plugin provided by " + path).
+		WithGroupID(PluginGroupID).
+		DisableFlagParsing().
+		WithRunEFunc(func(cmd *cobra.Command, args []string) error {
+			c := exec.Command(path, args...)
+			c.Stdin = cmd.InOrStdin()
+			c.Stdout = cmd.OutOrStdout()
+			c.Stderr = cmd.ErrOrStderr()
+			return c.Run()
+		}).
+		Build()
+}
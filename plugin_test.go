@@ -0,0 +1,45 @@
+package boa
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithPluginPrefix(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake plugin is a shell script")
+	}
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho \"hello plugin $@\"\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "boa-hello"), []byte(script), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "boa-notexec"), []byte(script), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "other-hello"), []byte(script), 0755))
+	t.Setenv("PATH", dir)
+
+	cmd := NewCobraCmd("boa").
+		WithSubCommands(NewCobraCmd("builtin").WithShortDescription("a builtin command").WithNoOp().Build()).
+		WithPluginPrefix("boa").
+		Build()
+
+	names := []string{}
+	for _, c := range cmd.Commands() {
+		names = append(names, c.Name())
+	}
+	assert.ElementsMatch(t, []string{"builtin", "hello"}, names)
+
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetArgs([]string{"-h"})
+	assert.NoError(t, cmd.Execute())
+	assert.Contains(t, out.String(), "Plugin Commands:\n  hello")
+
+	out.Reset()
+	cmd.SetArgs([]string{"hello", "--flag", "arg"})
+	assert.NoError(t, cmd.Execute())
+	assert.Equal(t, "hello plugin --flag arg\n", out.String())
+}
@@ -0,0 +1,79 @@
+package boa
+
+import (
+	"bytes"
+	"io"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+// WithOutputPrefix prefixes every line the command writes to its output with
+// its name in brackets, e.g. "[build] done", so that the output of
+// subcommands run by an orchestrating parent can be told apart. The
+// command's run function is wrapped when the command is built, so it may be
+// set before or after this is called.
+func (b *CobraCmdBuilder) WithOutputPrefix() *CobraCmdBuilder {
+	b.onBuild = append(b.onBuild, func() {
+		wrapRun(b.cmd, func(next runFunc) runFunc {
+			return func(cmd *cobra.Command, args []string) error {
+				out := cmd.OutOrStdout()
+				w := newPrefixWriter(out, "["+cmd.Name()+"] ")
+				cmd.SetOut(w)
+				defer cmd.SetOut(out)
+				err := next(cmd, args)
+				if flushErr := w.Flush(); err == nil {
+					err = flushErr
+				}
+				return err
+			}
+		})
+	})
+	return b
+}
+
+// prefixWriter is a writer that prefixes every line written to it. Partial
+// lines are buffered until they're completed or flushed.
+type prefixWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	prefix []byte
+	buf    []byte
+}
+
+func newPrefixWriter(w io.Writer, prefix string) *prefixWriter {
+	return &prefixWriter{w: w, prefix: []byte(prefix)}
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		if err := p.writeLine(p.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		p.buf = p.buf[i+1:]
+	}
+}
+
+// Flush writes any partial line that has been buffered.
+func (p *prefixWriter) Flush() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.buf) == 0 {
+		return nil
+	}
+	err := p.writeLine(p.buf)
+	p.buf = nil
+	return err
+}
+
+func (p *prefixWriter) writeLine(line []byte) error {
+	_, err := p.w.Write(append(append([]byte{}, p.prefix...), line...))
+	return err
+}
@@ -0,0 +1,88 @@
+package boa
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var (
+	// geteuid returns the effective user ID of the process. It is a variable
+	// so that tests can simulate running as a regular user.
+	geteuid = os.Geteuid
+	// runElevated runs the command line argv on behalf of cmd. It is a
+	// variable so that tests can capture the command line instead.
+	runElevated = func(cmd *cobra.Command, argv []string) error {
+		c := exec.Command(argv[0], argv[1:]...)
+		c.Stdin = cmd.InOrStdin()
+		c.Stdout = cmd.OutOrStdout()
+		c.Stderr = cmd.ErrOrStderr()
+		return c.Run()
+	}
+)
+
+// WithPrivilegeEscalation makes the command require root. When it is run by
+// another user, rather than failing deep in its run function, it re-execs
+// itself under sudo and returns the outcome of that run. The command line
+// of the re-exec is rebuilt from the path of the command and the flags and
+// args it was parsed with, so it runs the same command even when it was
+// executed with args other than the program's own.
+//
+// When stdin is a terminal sudo may prompt for a password; otherwise it is
+// run non-interactively so that it fails rather than hangs. This has no
+// effect on Windows. The command's run function is wrapped when the command
+// is built, so it may be set before or after this is called.
+func (b *CobraCmdBuilder) WithPrivilegeEscalation() *CobraCmdBuilder {
+	b.onBuild = append(b.onBuild, func() {
+		wrapRun(b.cmd, func(next runFunc) runFunc {
+			return func(cmd *cobra.Command, args []string) error {
+				if runtime.GOOS == "windows" || geteuid() == 0 {
+					return next(cmd, args)
+				}
+				exe, err := os.Executable()
+				if err != nil {
+					return err
+				}
+				return runElevated(cmd, sudoCommand(exe, commandLine(cmd, args), isTerminal(cmd.InOrStdin())))
+			}
+		})
+	})
+	return b
+}
+
+// sudoCommand returns the command line that runs exe with args under sudo.
+func sudoCommand(exe string, args []string, interactive bool) []string {
+	argv := []string{"sudo"}
+	if !interactive {
+		argv = append(argv, "-n")
+	}
+	argv = append(argv, "--", exe)
+	return append(argv, args...)
+}
+
+// commandLine returns the args that run cmd with the flags that were set and
+// args: the names of cmd and its parents below the root, each flag that was
+// changed and then args, after a "--" if any of them look like a flag.
+func commandLine(cmd *cobra.Command, args []string) []string {
+	line := strings.Fields(cmd.CommandPath())[1:]
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		if s, ok := f.Value.(pflag.SliceValue); ok {
+			for _, v := range s.GetSlice() {
+				line = append(line, "--"+f.Name+"="+v)
+			}
+			return
+		}
+		line = append(line, "--"+f.Name+"="+f.Value.String())
+	})
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			line = append(line, "--")
+			break
+		}
+	}
+	return append(line, args...)
+}
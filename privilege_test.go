@@ -0,0 +1,60 @@
+package boa
+
+import (
+	"io"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSudoCommand(t *testing.T) {
+	assert.Equal(t,
+		[]string{"sudo", "--", "/usr/bin/app", "install", "--force"},
+		sudoCommand("/usr/bin/app", []string{"install", "--force"}, true))
+	assert.Equal(t,
+		[]string{"sudo", "-n", "--", "/usr/bin/app", "install"},
+		sudoCommand("/usr/bin/app", []string{"install"}, false))
+}
+
+func TestWithPrivilegeEscalation(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("privilege escalation is not supported on windows")
+	}
+	defer func(euid func() int, run func(*cobra.Command, []string) error, tty func(io.Reader) bool) {
+		geteuid, runElevated, isTerminal = euid, run, tty
+	}(geteuid, runElevated, isTerminal)
+
+	var argv []string
+	ran := false
+	runElevated = func(_ *cobra.Command, a []string) error {
+		argv = a
+		return nil
+	}
+	isTerminal = func(io.Reader) bool { return true }
+	install := NewCobraCmd("install").
+		WithBoolFlag("force", false, "reinstall").
+		WithStringSliceFlag("tag", nil, "tags to add").
+		WithStringFlag("note", "", "install note").
+		WithRunFunc(func(*cobra.Command, []string) { ran = true }).
+		WithPrivilegeEscalation().
+		Build()
+	cmd := NewCobraCmd("app").WithSubCommands(install).Build()
+	cmd.PersistentFlags().Bool("verbose", false, "verbose output")
+	cmd.SetArgs([]string{"install", "pkg", "--force", "--tag", "a", "--tag", "b", "--verbose", "--", "-x"})
+
+	geteuid = func() int { return 1000 }
+	assert.NoError(t, cmd.Execute())
+	exe, _ := os.Executable()
+	assert.Equal(t, []string{"sudo", "--", exe, "install", "--force=true", "--tag=a", "--tag=b", "--verbose=true", "--", "pkg", "-x"}, argv)
+	assert.False(t, ran)
+
+	argv = nil
+	geteuid = func() int { return 0 }
+	cmd.SetArgs([]string{"install", "pkg"})
+	assert.NoError(t, cmd.Execute())
+	assert.Nil(t, argv)
+	assert.True(t, ran)
+}
@@ -0,0 +1,48 @@
+package boa
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// WithProfileFlag registers a persistent flag called name, such as "env" or
+// "profile", on cmd that selects a top-level section of the config to scope
+// reads to. With `mycli --env prod`, the keys of the prod section override
+// the keys they're nested under, so reading "db.host" returns "prod.db.host"
+// when it's set and "db.host" otherwise. The command fails if the section
+// doesn't exist.
+//
+// The profile's section is merged into the config read from files, so env
+// vars, bound flags and --set values still take precedence over it. The
+// config is processed again from what was read once the profile is
+// selected, so the profile's values are decrypted, transformed and
+// validated like any other, and it's merged again whenever the config is
+// reloaded.
+func (b *ViperCfgBuilder) WithProfileFlag(cmd *cobra.Command, name string) *ViperCfgBuilder {
+	profile := cmd.PersistentFlags().String(name, "", "config profile to use")
+	ToCobraCmdBuilder(cmd).beforePersistentPreRun(func(*cobra.Command, []string) error {
+		if *profile == "" {
+			return nil
+		}
+		b.reloadMu.Lock()
+		defer b.reloadMu.Unlock()
+		b.profile = *profile
+		return b.processRead()
+	})
+	return b
+}
+
+// mergeProfile merges the keys of the selected profile's section of v into
+// v.
+func (b *ViperCfgBuilder) mergeProfile(v *viper.Viper) error {
+	if b.profile == "" {
+		return nil
+	}
+	sub := v.Sub(b.profile)
+	if sub == nil {
+		return fmt.Errorf("unknown config profile %q", b.profile)
+	}
+	return v.MergeConfigMap(sub.AllSettings())
+}
@@ -0,0 +1,119 @@
+package boa
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/spf13/cobra"
+)
+
+// rateLimitLockTimeout is how long an invocation waits for another to finish
+// updating the rate limit state.
+const rateLimitLockTimeout = 5 * time.Second
+
+var (
+	// now and sleep tell and pass the time for the rate limiter. They are
+	// variables so that tests can use a fake clock.
+	now   = time.Now
+	sleep = time.Sleep
+	// rateLimitStateDir returns the directory the rate limit state of the
+	// program name is kept in. It is a variable so that tests can keep it
+	// somewhere else.
+	rateLimitStateDir = func(name string) string {
+		return filepath.Join(xdg.StateHome, name, "ratelimit")
+	}
+)
+
+// rateLimitState is the token bucket of a rate limited command.
+type rateLimitState struct {
+	Tokens float64   `json:"tokens"`
+	Last   time.Time `json:"last"`
+}
+
+// WithRateLimit throttles the command with a token bucket that holds up to
+// burst tokens and gains one every interval, so that scripts invoking it in
+// a tight loop don't trip the limits of the API it calls. Each run takes a
+// token, first waiting for one if the bucket is empty and reporting the wait
+// on stderr.
+//
+// The bucket is kept in a file in the user's state directory, so that it's
+// shared by separate invocations of the program. The command's run function
+// is wrapped when the command is built, so it may be set before or after
+// this is called.
+func (b *CobraCmdBuilder) WithRateLimit(interval time.Duration, burst int) *CobraCmdBuilder {
+	b.onBuild = append(b.onBuild, func() {
+		wrapRun(b.cmd, func(next runFunc) runFunc {
+			return func(cmd *cobra.Command, args []string) error {
+				name := strings.ReplaceAll(cmd.CommandPath(), " ", "-")
+				path := filepath.Join(rateLimitStateDir(cmd.Root().Name()), name+".json")
+				wait, err := takeToken(path, interval, burst)
+				if err != nil {
+					return fmt.Errorf("rate limiting: %w", err)
+				}
+				if wait > 0 {
+					fmt.Fprintf(cmd.ErrOrStderr(), "Rate limited, waiting %s\n", wait)
+					sleep(wait)
+				}
+				return next(cmd, args)
+			}
+		})
+	})
+	return b
+}
+
+// takeToken takes a token from the bucket stored at path, returning how long
+// to wait before the token is available.
+func takeToken(path string, interval time.Duration, burst int) (time.Duration, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return 0, err
+	}
+	unlock, err := lockFile(path+".lock", rateLimitLockTimeout)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	t := now()
+	state := rateLimitState{Tokens: float64(burst), Last: t}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return 0, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &state); err != nil {
+			return 0, err
+		}
+	}
+	if elapsed := t.Sub(state.Last); elapsed > 0 {
+		state.Tokens += float64(elapsed) / float64(interval)
+		state.Last = t
+	}
+	if state.Tokens > float64(burst) {
+		state.Tokens = float64(burst)
+	}
+	// Last is in the future when tokens have already been promised to
+	// invocations that are still waiting, so the next token comes after
+	// theirs rather than an interval from now.
+	var wait time.Duration
+	if state.Tokens < 1 {
+		ready := state.Last
+		if ready.Before(t) {
+			ready = t
+		}
+		ready = ready.Add(time.Duration((1 - state.Tokens) * float64(interval)))
+		wait = ready.Sub(t)
+		state.Tokens, state.Last = 1, ready
+	}
+	state.Tokens--
+	data, err = json.Marshal(state)
+	if err != nil {
+		return 0, err
+	}
+	return wait, os.WriteFile(path, data, 0o600)
+}
@@ -0,0 +1,87 @@
+package boa
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCobraCmdBuilderWithRateLimit(t *testing.T) {
+	dir := t.TempDir()
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var waits []time.Duration
+	defer func(n func() time.Time, s func(time.Duration), d func(string) string) {
+		now, sleep, rateLimitStateDir = n, s, d
+	}(now, sleep, rateLimitStateDir)
+	now = func() time.Time { return clock }
+	sleep = func(d time.Duration) {
+		waits = append(waits, d)
+		clock = clock.Add(d)
+	}
+	rateLimitStateDir = func(string) string { return dir }
+
+	runs := 0
+	stderr := new(bytes.Buffer)
+	execute := func() {
+		cmd := NewCobraCmd("app").
+			WithRunFunc(func(cmd *cobra.Command, args []string) { runs++ }).
+			WithRateLimit(time.Second, 2).
+			Build()
+		cmd.SetErr(stderr)
+		cmd.SetArgs([]string{})
+		assert.NoError(t, cmd.Execute())
+	}
+
+	for i := 0; i < 4; i++ {
+		execute()
+	}
+	assert.Equal(t, 4, runs)
+	assert.Equal(t, []time.Duration{time.Second, time.Second}, waits)
+	assert.Equal(t, "Rate limited, waiting 1s\nRate limited, waiting 1s\n", stderr.String())
+
+	clock = clock.Add(1500 * time.Millisecond)
+	execute()
+	execute()
+	assert.Equal(t, []time.Duration{time.Second, time.Second, 500 * time.Millisecond}, waits)
+}
+
+func TestCobraCmdBuilderWithRateLimitConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var mu sync.Mutex
+	var waits []time.Duration
+	defer func(n func() time.Time, s func(time.Duration), d func(string) string) {
+		now, sleep, rateLimitStateDir = n, s, d
+	}(now, sleep, rateLimitStateDir)
+	// The clock stands still, as if every invocation started at once.
+	now = func() time.Time { return clock }
+	sleep = func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		waits = append(waits, d)
+	}
+	rateLimitStateDir = func(string) string { return dir }
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cmd := NewCobraCmd("app").
+				WithRunFunc(func(cmd *cobra.Command, args []string) {}).
+				WithRateLimit(time.Second, 2).
+				Build()
+			cmd.SetErr(new(bytes.Buffer))
+			cmd.SetArgs([]string{})
+			assert.NoError(t, cmd.Execute())
+		}()
+	}
+	wg.Wait()
+	sort.Slice(waits, func(i, j int) bool { return waits[i] < waits[j] })
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}, waits)
+}
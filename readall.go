@@ -0,0 +1,128 @@
+package boa
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/viper"
+)
+
+// FindConfigFiles returns every config file named by WithConfigName, or
+// "config" by default, in the config paths, in order of precedence. Like
+// viper, only the first file with a supported extension is found in each
+// path, and only files with the extension set by WithConfigType if there is
+// one.
+func (b *ViperCfgBuilder) FindConfigFiles() []string {
+	exts := viper.SupportedExts
+	if b.configType != "" {
+		exts = []string{b.configType}
+	}
+	name := b.configName
+	if name == "" {
+		name = "config"
+	}
+	var files []string
+	seen := map[string]bool{}
+	for _, p := range b.configPaths {
+		for _, ext := range exts {
+			f := filepath.Join(p, name+"."+ext)
+			if info, err := os.Stat(f); err != nil || info.IsDir() {
+				continue
+			}
+			if !seen[f] {
+				seen[f] = true
+				files = append(files, f)
+			}
+			break
+		}
+	}
+	return files
+}
+
+// ReadAllInConfig will read every config file found by FindConfigFiles,
+// rather than only the first, merging them so that files in paths of higher
+// precedence override those of lower precedence. This supports layered
+// configuration, such as a project config overriding a user config.
+//
+// If an error is encountered, logs fatal
+func (b *ViperCfgBuilder) ReadAllInConfig() *ViperCfgBuilder {
+	err := b.readAllInConfig()
+	if err != nil {
+		log.Fatalf("Error reading in config: %v", err)
+	}
+	return b
+}
+
+// TryReadAllInConfig is like ReadAllInConfig, but returns the error instead
+// of logging fatal. Like TryReadInConfig, a viper.ConfigFileNotFoundError is
+// returned when no config file is found in the config paths.
+func (b *ViperCfgBuilder) TryReadAllInConfig() (*ViperCfgBuilder, error) {
+	return b, b.readAllInConfig()
+}
+
+// configFilesNotFoundError is returned when no config file is found by
+// FindConfigFiles. It names the files looked for, which
+// viper.ConfigFileNotFoundError can't be built with outside of viper, while
+// still matching it with errors.As.
+type configFilesNotFoundError struct {
+	name  string
+	paths []string
+}
+
+func (e configFilesNotFoundError) Error() string {
+	return fmt.Sprintf("config file %q not found in %v", e.name, e.paths)
+}
+
+func (e configFilesNotFoundError) Unwrap() error {
+	return viper.ConfigFileNotFoundError{}
+}
+
+func (b *ViperCfgBuilder) readAllInConfig() error {
+	if b.envOnly {
+		return b.afterRead()
+	}
+	files := b.FindConfigFiles()
+	if len(files) == 0 {
+		return configFilesNotFoundError{b.configName, b.configPaths}
+	}
+	data, err := b.readTimed(func(ctx context.Context) ([][]byte, error) {
+		return readFilesContext(ctx, files)
+	})
+	if err != nil {
+		return err
+	}
+	sources := fileSources(files, data)
+	if err := b.checkSources(sources); err != nil {
+		return err
+	}
+	b.sources, b.rebuildable = sources, true
+	b.configFile, b.configFiles = "", files
+	return b.afterRead()
+}
+
+// readFilesContext reads each of files, stopping once ctx is done.
+func readFilesContext(ctx context.Context, files []string) ([][]byte, error) {
+	data := make([][]byte, len(files))
+	for i, f := range files {
+		d, err := readFileContext(ctx, f)
+		if err != nil {
+			return nil, err
+		}
+		data[i] = d
+	}
+	return data, nil
+}
+
+// fileSources returns the sources of the data read from files, which are in
+// order of precedence, ordered from the lowest precedence to the highest.
+func fileSources(files []string, data [][]byte) []configSource {
+	sources := make([]configSource, len(files))
+	for i := range files {
+		j := len(files) - 1 - i
+		sources[i] = configSource{files[j], data[j]}
+	}
+	return sources
+}
@@ -0,0 +1,131 @@
+package boa
+
+import (
+	"log"
+	"reflect"
+	"sort"
+
+	"github.com/spf13/viper"
+)
+
+// WithRestartRequiredKeys marks config keys, such as a listen address, whose
+// changes can't take effect without restarting. Every other key is assumed
+// to be hot-reloadable. When Reload finds that one of these keys changed, it
+// logs a warning so that users don't assume the change took effect.
+func (b *ViperCfgBuilder) WithRestartRequiredKeys(keys ...string) *ViperCfgBuilder {
+	b.restartKeys = append(b.restartKeys, keys...)
+	return b
+}
+
+// WithReloadFunc sets a function that Reload calls once with every key
+// changed by the reload, sorted, so that callers can reconcile all changes in
+// a single pass rather than reacting to each key. It isn't called when a
+// reload changes nothing.
+func (b *ViperCfgBuilder) WithReloadFunc(f func(changed []string)) *ViperCfgBuilder {
+	b.reloadFuncs = append(b.reloadFuncs, f)
+	return b
+}
+
+// Reload reads the config file, or files when read with ReadAllInConfig or
+// merged with WithMergeConfigFiles, again and returns the keys whose values
+// changed, sorted. A warning is logged for each changed key that was marked
+// restart-required.
+//
+// The config is read and processed while holding the lock that Snapshot
+// takes, so a snapshot never sees a config that's partly reloaded.
+func (b *ViperCfgBuilder) Reload() ([]string, error) {
+	b.reloadMu.Lock()
+	before := b.snapshot()
+	var err error
+	if b.mergeFiles != nil {
+		err = b.readMergeFiles()
+	} else if b.configFiles != nil {
+		err = b.readAllInConfig()
+	} else {
+		err = b.readInConfig()
+	}
+	var changed []string
+	if err == nil {
+		changed = changedKeys(before, b.snapshot())
+	}
+	b.reloadMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	restart := map[string]bool{}
+	for _, k := range b.restartKeys {
+		restart[k] = true
+	}
+	for _, k := range changed {
+		if restart[k] {
+			log.Printf("Config key %q changed, restart for the change to take effect", k)
+		}
+	}
+	if len(changed) > 0 {
+		for _, f := range b.reloadFuncs {
+			f(changed)
+		}
+	}
+	return changed, nil
+}
+
+// Snapshot returns a copy of the current settings that later reloads leave
+// untouched, so that a Run function reading several related keys sees them
+// all from the same version of the config rather than half old, half new.
+func (b *ViperCfgBuilder) Snapshot() *viper.Viper {
+	b.reloadMu.RLock()
+	settings := copyValue(b.cfg.AllSettings()).(map[string]any)
+	b.reloadMu.RUnlock()
+	v := viper.New()
+	_ = v.MergeConfigMap(settings)
+	return v
+}
+
+// copyValue returns a deep copy of v's maps and slices.
+func copyValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[k] = copyValue(e)
+		}
+		return m
+	case []any:
+		s := make([]any, len(v))
+		for i, e := range v {
+			s[i] = copyValue(e)
+		}
+		return s
+	case []string:
+		return append([]string(nil), v...)
+	default:
+		return v
+	}
+}
+
+// snapshot returns the current value of every key.
+func (b *ViperCfgBuilder) snapshot() map[string]any {
+	values := map[string]any{}
+	for _, k := range b.cfg.AllKeys() {
+		values[k] = b.cfg.Get(k)
+	}
+	return values
+}
+
+// changedKeys returns the sorted keys whose values differ between before and
+// after, including keys only in one of them.
+func changedKeys(before map[string]any, after map[string]any) []string {
+	var changed []string
+	for k, v := range after {
+		if old, ok := before[k]; !ok || !reflect.DeepEqual(old, v) {
+			changed = append(changed, k)
+		}
+	}
+	for k := range before {
+		if _, ok := after[k]; !ok {
+			changed = append(changed, k)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
@@ -0,0 +1,46 @@
+package boa
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// WithInheritedRequiredFlags makes every descendant of the command enforce
+// the command's persistent flags that are marked required, failing with
+// e.g. `required flag(s) "token" not set` before the descendant's pre-run
+// function runs. The descendants are walked when this is called, so it
+// should be called after adding subcommands.
+func (b *CobraCmdBuilder) WithInheritedRequiredFlags() *CobraCmdBuilder {
+	var required []string
+	b.cmd.PersistentFlags().VisitAll(func(f *pflag.Flag) {
+		if v, ok := f.Annotations[cobra.BashCompOneRequiredFlag]; ok && len(v) > 0 && v[0] == "true" {
+			required = append(required, f.Name)
+		}
+	})
+	if len(required) == 0 {
+		return b
+	}
+	check := func(cmd *cobra.Command, args []string) error {
+		var missing []string
+		for _, name := range required {
+			if f := cmd.Flags().Lookup(name); f != nil && !f.Changed {
+				missing = append(missing, name)
+			}
+		}
+		if len(missing) > 0 {
+			sort.Strings(missing)
+			return fmt.Errorf(`required flag(s) "%s" not set`, strings.Join(missing, `", "`))
+		}
+		return nil
+	}
+	for _, sub := range b.cmd.Commands() {
+		walk(sub, func(cmd *cobra.Command) {
+			cmd.PreRunE = runBefore(check, cmd.PreRunE, cmd.PreRun)
+		})
+	}
+	return b
+}
@@ -0,0 +1,56 @@
+package boa
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// WithConfigResetCmd adds a reset subcommand to cmd, typically a `config`
+// command, that overwrites the config file with the defaults set through
+// WithDefault and WithDefaultsFromStruct, discarding any customizations. The
+// user is asked to confirm first, as with WithConfirmation.
+func (b *ViperCfgBuilder) WithConfigResetCmd(cmd *cobra.Command) *ViperCfgBuilder {
+	reset := NewCmd("reset").
+		WithConfirmation("Reset the config file to its defaults?").
+		WithShortDescription("Reset the config file to its defaults").
+		WithArgs(cobra.NoArgs).
+		WithRunEFunc(func(cmd *cobra.Command, args []string) error {
+			path, err := b.resetConfigFile()
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Reset %s to its defaults\n", path)
+			return nil
+		}).
+		Build()
+	cmd.AddCommand(reset)
+	return b
+}
+
+// resetConfigFile writes the defaults to the config file in use and returns
+// its path.
+func (b *ViperCfgBuilder) resetConfigFile() (string, error) {
+	path := b.configFilePath()
+	if path == "" {
+		return "", ErrNoConfigFile
+	}
+	defaults := viper.New()
+	for _, m := range []map[string]any{b.structDefaults, b.defaults} {
+		for k := range m {
+			if b.isSecret(k) {
+				continue
+			}
+			v, _ := b.defaultValue(k)
+			defaults.Set(k, v)
+		}
+	}
+	err := b.writeLocked(path, func() error {
+		return defaults.WriteConfigAs(path)
+	})
+	if err != nil {
+		return "", fmt.Errorf("resetting config file: %w", err)
+	}
+	return path, nil
+}
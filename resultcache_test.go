@@ -0,0 +1,50 @@
+package boa
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCobraCmdBuilderWithCommandResultCaching(t *testing.T) {
+	dir := t.TempDir()
+	clock := time.Now()
+	defer func(n func() time.Time, d func(string) string) {
+		now, resultCacheDir = n, d
+	}(now, resultCacheDir)
+	now = func() time.Time { return clock }
+	resultCacheDir = func(string) string { return dir }
+
+	cfg := NewViperCfg().WithDefault("region", "us-east-1")
+	runs := 0
+	execute := func(args ...string) string {
+		cmd := NewCobraCmd("query").
+			WithRunFunc(func(cmd *cobra.Command, args []string) {
+				runs++
+				fmt.Fprintf(cmd.OutOrStdout(), "%s in %s, run %d\n", args, cfg.Build().GetString("region"), runs)
+			}).
+			WithCommandResultCaching(time.Minute, cfg).
+			Build()
+		stdout := new(bytes.Buffer)
+		cmd.SetOut(stdout)
+		cmd.SetArgs(args)
+		assert.NoError(t, cmd.Execute())
+		return stdout.String()
+	}
+
+	assert.Equal(t, "[users] in us-east-1, run 1\n", execute("users"))
+	assert.Equal(t, "[users] in us-east-1, run 1\n", execute("users"))
+	assert.Equal(t, 1, runs)
+
+	assert.Equal(t, "[groups] in us-east-1, run 2\n", execute("groups"))
+
+	cfg.WithDefault("region", "eu-west-1")
+	assert.Equal(t, "[users] in eu-west-1, run 3\n", execute("users"))
+
+	clock = clock.Add(2 * time.Minute)
+	assert.Equal(t, "[users] in eu-west-1, run 4\n", execute("users"))
+}
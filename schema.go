@@ -0,0 +1,108 @@
+package boa
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// ExportSchema writes a JSON Schema to w describing the config keys known to
+// the builder through WithDefault and WithDefaultsFromStruct, along with
+// their types and defaults. Dot delimited keys are described as nested
+// objects. Publishing the schema lets editors validate and autocomplete
+// config files.
+func (b *ViperCfgBuilder) ExportSchema(w io.Writer) error {
+	root := map[string]any{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type":    "object",
+	}
+	keys := map[string]bool{}
+	for k := range b.structDefaults {
+		keys[k] = true
+	}
+	for k := range b.defaults {
+		keys[k] = true
+	}
+	for k := range keys {
+		v, _ := b.defaultValue(k)
+		parent := root
+		path := strings.Split(k, ".")
+		for _, name := range path[:len(path)-1] {
+			parent = schemaProperty(parent, name)
+			parent["type"] = "object"
+		}
+		prop := schemaProperty(parent, path[len(path)-1])
+		for field, value := range valueSchema(v) {
+			prop[field] = value
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(root)
+}
+
+// schemaProperty returns the schema of the property name of the object
+// schema parent, adding it if it doesn't exist yet.
+func schemaProperty(parent map[string]any, name string) map[string]any {
+	props, ok := parent["properties"].(map[string]any)
+	if !ok {
+		props = map[string]any{}
+		parent["properties"] = props
+	}
+	prop, ok := props[name].(map[string]any)
+	if !ok {
+		prop = map[string]any{}
+		props[name] = prop
+	}
+	return prop
+}
+
+// valueSchema returns the schema of the default value v.
+func valueSchema(v any) map[string]any {
+	schema := typeSchema(reflect.TypeOf(v))
+	if v == nil {
+		return schema
+	}
+	switch d := v.(type) {
+	case time.Duration:
+		schema["default"] = d.String()
+	default:
+		schema["default"] = v
+	}
+	return schema
+}
+
+// typeSchema returns the schema describing values of type t, in the form
+// viper would accept them from a config file.
+func typeSchema(t reflect.Type) map[string]any {
+	if t == nil {
+		return map[string]any{}
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t {
+	case reflect.TypeOf(time.Duration(0)):
+		return map[string]any{"type": "string"}
+	case reflect.TypeOf(time.Time{}):
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map, reflect.Struct:
+		return map[string]any{"type": "object"}
+	}
+	return map[string]any{}
+}
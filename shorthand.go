@@ -0,0 +1,28 @@
+package boa
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+)
+
+// WithRemovedShorthand is used to guide users still using a shorthand flag
+// that was removed, or freed up to mean something else, towards its
+// replacement. Rather than pflag's generic "unknown shorthand flag" error,
+// using the shorthand fails with e.g. "shorthand flag -v has been removed,
+// use --verbose instead". Subcommands inherit the guidance unless they set a
+// flag error function of their own.
+func (b *CobraCmdBuilder) WithRemovedShorthand(shorthand string, replacement string) *CobraCmdBuilder {
+	c, _ := utf8.DecodeRuneInString(shorthand)
+	unknown := fmt.Sprintf("unknown shorthand flag: %q in -", c)
+	next := b.cmd.FlagErrorFunc()
+	b.cmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		if strings.HasPrefix(err.Error(), unknown) {
+			return fmt.Errorf("shorthand flag -%s has been removed, use %s instead", shorthand, replacement)
+		}
+		return next(cmd, err)
+	})
+	return b
+}
@@ -0,0 +1,58 @@
+package boa
+
+import "time"
+
+// ConfigStats describes the most recent successful load of the config.
+type ConfigStats struct {
+	// Files are the config files read, in order of precedence. It's empty
+	// when the config was read from a reader.
+	Files []string
+	// Keys is the number of keys set once the config was loaded.
+	Keys int
+	// Duration is how long loading the config took.
+	Duration time.Duration
+	// LoadedAt is when the config finished loading.
+	LoadedAt time.Time
+	// Loads is the number of times the config has been loaded, including
+	// reloads.
+	Loads int
+}
+
+// Stats returns the stats of the most recent successful load of the config,
+// so that operators can confirm it's loading as expected.
+func (b *ViperCfgBuilder) Stats() ConfigStats {
+	b.reloadMu.RLock()
+	defer b.reloadMu.RUnlock()
+	stats := b.stats
+	stats.Files = append([]string(nil), stats.Files...)
+	return stats
+}
+
+// WithStatsFunc sets a function that's called with the stats of every
+// successful load and reload of the config, e.g. to log them or export them
+// as metrics. f may be called while a reload holds the config's lock, so it
+// should use the stats it's given rather than calling Stats or Snapshot.
+func (b *ViperCfgBuilder) WithStatsFunc(f func(ConfigStats)) *ViperCfgBuilder {
+	b.statsFuncs = append(b.statsFuncs, f)
+	return b
+}
+
+// recordStats records the stats of a load of the config that took d.
+func (b *ViperCfgBuilder) recordStats(d time.Duration) {
+	var files []string
+	if b.configFiles != nil {
+		files = append(files, b.configFiles...)
+	} else if b.configFile != "" {
+		files = []string{b.configFile}
+	}
+	b.stats = ConfigStats{
+		Files:    files,
+		Keys:     len(b.cfg.AllKeys()),
+		Duration: d,
+		LoadedAt: time.Now(),
+		Loads:    b.stats.Loads + 1,
+	}
+	for _, f := range b.statsFuncs {
+		f(b.stats)
+	}
+}
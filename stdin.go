@@ -0,0 +1,34 @@
+package boa
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// DecodeStdin reads a JSON or YAML document from the command's input and
+// decodes it into target. JSON is assumed when the document starts with '{'
+// or '[', and YAML otherwise.
+//
+// The document is read from cmd.InOrStdin(), so tests can supply it with
+// cmd.SetIn.
+func DecodeStdin(cmd *cobra.Command, target any) error {
+	data, err := io.ReadAll(cmd.InOrStdin())
+	if err != nil {
+		return fmt.Errorf("reading stdin: %w", err)
+	}
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		err = json.Unmarshal(trimmed, target)
+	} else {
+		err = yaml.Unmarshal(data, target)
+	}
+	if err != nil {
+		return fmt.Errorf("decoding stdin: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package boa
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeStdin(t *testing.T) {
+	type doc struct {
+		Name  string   `json:"name" yaml:"name"`
+		Tags  []string `json:"tags" yaml:"tags"`
+		Count int      `json:"count" yaml:"count"`
+	}
+	expected := doc{Name: "boa", Tags: []string{"cli", "config"}, Count: 2}
+
+	tests := map[string]string{
+		"json": `  {"name": "boa", "tags": ["cli", "config"], "count": 2}`,
+		"yaml": "name: boa\ntags:\n  - cli\n  - config\ncount: 2\n",
+	}
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			cmd := NewCobraCmd("test").Build()
+			cmd.SetIn(strings.NewReader(input))
+			var actual doc
+			assert.NoError(t, DecodeStdin(cmd, &actual))
+			assert.Equal(t, expected, actual)
+		})
+	}
+
+	cmd := NewCobraCmd("test").Build()
+	cmd.SetIn(strings.NewReader("{not json"))
+	assert.ErrorContains(t, DecodeStdin(cmd, &doc{}), "decoding stdin")
+}
@@ -0,0 +1,130 @@
+package boa
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// StrictMode controls how a StrictViper reacts to reading a key that was
+// never set.
+type StrictMode int
+
+const (
+	// StrictError makes StrictViper getters return an UnsetKeyError.
+	StrictError StrictMode = iota
+	// StrictPanic makes StrictViper getters panic with an UnsetKeyError.
+	StrictPanic
+)
+
+// UnsetKeyError is reported by a StrictViper when a key that has no value,
+// not even a default, is read.
+type UnsetKeyError struct {
+	Key string
+}
+
+func (e UnsetKeyError) Error() string {
+	return fmt.Sprintf("config key %q is not set", e.Key)
+}
+
+// StrictViper wraps a viper.Viper so that reading a key that was never set
+// is reported rather than silently returning the zero value. This is mostly
+// useful during development to catch typos in key names.
+type StrictViper struct {
+	cfg  *viper.Viper
+	mode StrictMode
+}
+
+// WithStrictKeys sets how the StrictViper returned by BuildStrict reacts to
+// reading a key that was never set.
+func (b *ViperCfgBuilder) WithStrictKeys(mode StrictMode) *ViperCfgBuilder {
+	b.strictMode = mode
+	return b
+}
+
+// BuildStrict returns a StrictViper from a ViperCfgBuilder, starting to
+// watch the config file if WithWatch was used, like Build.
+func (b *ViperCfgBuilder) BuildStrict() *StrictViper {
+	return &StrictViper{cfg: b.Build(), mode: b.strictMode}
+}
+
+// Viper returns the underlying viper.Viper.
+func (s *StrictViper) Viper() *viper.Viper {
+	return s.cfg
+}
+
+// Get returns the value of key.
+func (s *StrictViper) Get(key string) (any, error) {
+	if err := s.check(key); err != nil {
+		return nil, err
+	}
+	return s.cfg.Get(key), nil
+}
+
+// GetString returns the value of key as a string.
+func (s *StrictViper) GetString(key string) (string, error) {
+	if err := s.check(key); err != nil {
+		return "", err
+	}
+	return s.cfg.GetString(key), nil
+}
+
+// GetBool returns the value of key as a bool.
+func (s *StrictViper) GetBool(key string) (bool, error) {
+	if err := s.check(key); err != nil {
+		return false, err
+	}
+	return s.cfg.GetBool(key), nil
+}
+
+// GetInt returns the value of key as an int.
+func (s *StrictViper) GetInt(key string) (int, error) {
+	if err := s.check(key); err != nil {
+		return 0, err
+	}
+	return s.cfg.GetInt(key), nil
+}
+
+// GetFloat64 returns the value of key as a float64.
+func (s *StrictViper) GetFloat64(key string) (float64, error) {
+	if err := s.check(key); err != nil {
+		return 0, err
+	}
+	return s.cfg.GetFloat64(key), nil
+}
+
+// GetDuration returns the value of key as a time.Duration.
+func (s *StrictViper) GetDuration(key string) (time.Duration, error) {
+	if err := s.check(key); err != nil {
+		return 0, err
+	}
+	return s.cfg.GetDuration(key), nil
+}
+
+// GetStringSlice returns the value of key as a slice of strings.
+func (s *StrictViper) GetStringSlice(key string) ([]string, error) {
+	if err := s.check(key); err != nil {
+		return nil, err
+	}
+	return s.cfg.GetStringSlice(key), nil
+}
+
+// GetStringMap returns the value of key as a map of interfaces.
+func (s *StrictViper) GetStringMap(key string) (map[string]any, error) {
+	if err := s.check(key); err != nil {
+		return nil, err
+	}
+	return s.cfg.GetStringMap(key), nil
+}
+
+func (s *StrictViper) check(key string) error {
+	if s.cfg.IsSet(key) {
+		return nil
+	}
+	err := UnsetKeyError{Key: key}
+	if s.mode == StrictPanic {
+		panic(err)
+	}
+	return err
+}
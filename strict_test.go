@@ -0,0 +1,52 @@
+package boa
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStrictViper(t *testing.T) {
+	b := NewViperCfg().WithDefault("port", 8080)
+	b.Build().Set("name", "app")
+	strict := b.BuildStrict()
+
+	name, err := strict.GetString("name")
+	assert.NoError(t, err)
+	assert.Equal(t, "app", name)
+	port, err := strict.GetInt("port")
+	assert.NoError(t, err)
+	assert.Equal(t, 8080, port)
+	_, err = strict.GetString("nmae")
+	assert.Equal(t, UnsetKeyError{Key: "nmae"}, err)
+
+	strict = b.WithStrictKeys(StrictPanic).BuildStrict()
+	assert.PanicsWithValue(t, UnsetKeyError{Key: "prot"}, func() {
+		strict.GetInt("prot")
+	})
+}
+
+func TestStrictViperWatch(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte("level: info"), 0o600))
+	changed := make(chan struct{}, 10)
+	strict := NewViperCfg().
+		WithConfigFiles(file).
+		WithWatch(func(fsnotify.Event) { changed <- struct{}{} }).
+		ReadInConfig().
+		BuildStrict()
+
+	assert.NoError(t, os.WriteFile(file, []byte("level: debug"), 0o600))
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for config change")
+	}
+	level, err := strict.GetString("level")
+	assert.NoError(t, err)
+	assert.Equal(t, "debug", level)
+}
@@ -0,0 +1,101 @@
+package boa
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// WithAliasSuggestions is used to make the "unknown command" error suggest
+// subcommands whose aliases are close to what was typed, as well as those
+// whose names are, so that e.g. `app delte` suggests remove when it has the
+// alias delete. Suggestions follow the command's SuggestionsMinimumDistance
+// and DisableSuggestions settings like cobra's own.
+//
+// cobra only validates the args of runnable commands, so a command without a
+// run function is given one that shows its help, as cobra does for it. The
+// unknown command check replaces cobra's default args validation, so this has
+// no effect on a command with an args validator of its own.
+func (b *CobraCmdBuilder) WithAliasSuggestions() *CobraCmdBuilder {
+	if b.cmd.Args != nil {
+		return b
+	}
+	if !b.cmd.Runnable() {
+		b.cmd.RunE = func(cmd *cobra.Command, args []string) error {
+			return cmd.Help()
+		}
+	}
+	b.cmd.Args = func(cmd *cobra.Command, args []string) error {
+		if !cmd.HasSubCommands() || len(args) == 0 {
+			return nil
+		}
+		return fmt.Errorf("unknown command %q for %q%s", args[0], cmd.CommandPath(), aliasSuggestions(cmd, args[0]))
+	}
+	return b
+}
+
+// aliasSuggestions returns the "Did you mean this?" text listing the
+// subcommands of cmd whose names or aliases are close to typed.
+func aliasSuggestions(cmd *cobra.Command, typed string) string {
+	if cmd.DisableSuggestions {
+		return ""
+	}
+	if cmd.SuggestionsMinimumDistance <= 0 {
+		cmd.SuggestionsMinimumDistance = 2
+	}
+	suggestions := cmd.SuggestionsFor(typed)
+	seen := map[string]bool{}
+	for _, s := range suggestions {
+		seen[s] = true
+	}
+	for _, sub := range cmd.Commands() {
+		if !sub.IsAvailableCommand() || seen[sub.Name()] {
+			continue
+		}
+		for _, alias := range sub.Aliases {
+			if levenshtein(strings.ToLower(typed), strings.ToLower(alias)) <= cmd.SuggestionsMinimumDistance ||
+				strings.HasPrefix(strings.ToLower(alias), strings.ToLower(typed)) {
+				suggestions = append(suggestions, sub.Name())
+				seen[sub.Name()] = true
+				break
+			}
+		}
+	}
+	if len(suggestions) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("\n\nDid you mean this?\n")
+	for _, s := range suggestions {
+		fmt.Fprintf(&b, "\t%v\n", s)
+	}
+	return b.String()
+}
+
+// levenshtein returns the edit distance between s and t.
+func levenshtein(s string, t string) int {
+	prev := make([]int, len(t)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		cur := make([]int, len(t)+1)
+		cur[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if d := prev[j] + 1; d < cur[j] {
+				cur[j] = d
+			}
+			if d := cur[j-1] + 1; d < cur[j] {
+				cur[j] = d
+			}
+		}
+		prev = cur
+	}
+	return prev[len(t)]
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"sync"
 	"text/template"
 	"unicode"
 )
@@ -14,6 +15,8 @@ var templateFuncs = template.FuncMap{
 	"trimTrailingWhitespaces": trimRightSpace,
 	"rpad":                    rpad,
 	"sliceToCsv":              sliceToCsv,
+	"wrap":                    wrap,
+	"shellQuote":              ShellQuote,
 }
 
 // trimRightSpace trims any trailing whitespace
@@ -32,10 +35,59 @@ func sliceToCsv(args []string) string {
 	return strings.Join(args, ", ")
 }
 
+// wrap word wraps each line of s so that it fits within width, preserving
+// existing newlines. Words longer than width are left intact, and a width of
+// zero or less disables wrapping.
+func wrap(width int, s string) string {
+	if width <= 0 {
+		return s
+	}
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if len(line) <= width {
+			continue
+		}
+		var b strings.Builder
+		n := 0
+		for _, word := range strings.Fields(line) {
+			if n > 0 && n+1+len(word) > width {
+				b.WriteString("\n")
+				n = 0
+			} else if n > 0 {
+				b.WriteString(" ")
+				n++
+			}
+			b.WriteString(word)
+			n += len(word)
+		}
+		lines[i] = b.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// templates caches the parsed templates used by tmpl, keyed by their text,
+// so that help shown repeatedly isn't parsed every time.
+var templates sync.Map
+
 // tmpl executes the given template text on data, writing the result to w.
 func tmpl(w io.Writer, text string, data interface{}) error {
-	t := template.New("tmpl")
-	t.Funcs(templateFuncs)
-	template.Must(t.Parse(text))
+	t, err := parseTemplate(text)
+	if err != nil {
+		return err
+	}
 	return t.Execute(w, data)
 }
+
+// parseTemplate returns the parsed template of text, parsing it only the
+// first time it's seen.
+func parseTemplate(text string) (*template.Template, error) {
+	if t, ok := templates.Load(text); ok {
+		return t.(*template.Template), nil
+	}
+	t, err := template.New("tmpl").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	templates.Store(text, t)
+	return t, nil
+}
@@ -0,0 +1,38 @@
+package boa
+
+import (
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTmplInvalidTemplate(t *testing.T) {
+	assert.NotPanics(t, func() {
+		err := tmpl(io.Discard, "{{.Name", Command{})
+		assert.ErrorContains(t, err, "unclosed action")
+	})
+}
+
+func BenchmarkTmpl(b *testing.B) {
+	cmd := NewCmd("bench").
+		WithOptions(Option{Args: []string{"option"}, Desc: "an option"}).
+		WithProfiles(Profile{Args: []string{"profile"}, Opts: []string{"option"}, Desc: "a profile"}).
+		Build()
+	text := cmd.OptionsTemplate()
+
+	b.Run("cached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			tmpl(io.Discard, text, cmd)
+		}
+	})
+	b.Run("uncached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			templates = sync.Map{}
+			tmpl(io.Discard, text, cmd)
+		}
+	})
+}
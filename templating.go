@@ -0,0 +1,55 @@
+package boa
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// WithConfigTemplating makes string values containing Go template actions
+// render against data once the configuration has been read, e.g.
+//
+//	cache_dir: {{.Home}}/.cache/myapp
+//
+// A value that fails to parse or execute, such as one referencing a field
+// data doesn't have, is kept as it is and a warning naming its key is
+// logged, so that one bad value doesn't prevent the rest from rendering.
+// Templates are rendered after key references are resolved with
+// WithKeyInterpolation.
+//
+// Rendered values are stored as config file values, so env vars and flags
+// keep their precedence over them but aren't rendered themselves.
+func (b *ViperCfgBuilder) WithConfigTemplating(data any) *ViperCfgBuilder {
+	b.templating = true
+	b.templateData = data
+	return b
+}
+
+// renderTemplates renders the templates of every string value.
+func (b *ViperCfgBuilder) renderTemplates() error {
+	if !b.templating {
+		return nil
+	}
+	keys := b.cfg.AllKeys()
+	sort.Strings(keys)
+	for _, k := range keys {
+		v, ok := b.cfg.Get(k).(string)
+		if !ok || !strings.Contains(v, "{{") {
+			continue
+		}
+		var out strings.Builder
+		t, err := template.New(k).Option("missingkey=error").Parse(v)
+		if err == nil {
+			err = t.Execute(&out, b.templateData)
+		}
+		if err != nil {
+			log.Printf("Not rendering config key %q: %v", k, err)
+			continue
+		}
+		if err := b.cfg.MergeConfigMap(nestedMap(k, out.String())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package boa
+
+import (
+	"io"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// terminalWidth returns the width of the terminal backing w and whether w is
+// a terminal at all. It is a variable so that tests can simulate terminals of
+// a given width.
+var terminalWidth = func(w io.Writer) (int, bool) {
+	f, ok := w.(*os.File)
+	if !ok || !term.IsTerminal(int(f.Fd())) {
+		return 0, false
+	}
+	width, _, err := term.GetSize(int(f.Fd()))
+	if err != nil {
+		return 0, false
+	}
+	return width, true
+}
+
+// isTerminal returns whether r is a terminal. It is a variable so that tests
+// can simulate one.
+var isTerminal = func(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
@@ -0,0 +1,132 @@
+package boa
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// TraceFlagName is the name of the hidden flag registered by WithTraceFlag to
+// enable tracing.
+const TraceFlagName = "trace"
+
+// WithTraceFlag registers a hidden persistent --trace flag that, when set,
+// writes the lifecycle of the executed command to stderr: the boundaries of
+// its PreRun, Run and PostRun functions, its flags and, for each of cfgs, the
+// config file read and the layer each config key came from. It is meant to
+// help diagnose user issues without rebuilding the CLI. The values of flags
+// whose names look like they hold secrets, such as --password or --api-token,
+// are redacted, as they are by WithExplainFlag.
+//
+// The flag is checked each time a command is executed, by wrapping the
+// functions of the command and its subcommands when it's built, so
+// subcommands should be added before then.
+func (b *CobraCmdBuilder) WithTraceFlag(cfgs ...*ViperCfgBuilder) *CobraCmdBuilder {
+	b.cmd.PersistentFlags().Bool(TraceFlagName, false, "trace the command lifecycle to stderr")
+	_ = b.cmd.PersistentFlags().MarkHidden(TraceFlagName)
+	b.onBuild = append(b.onBuild, func() {
+		walk(b.cmd, func(cmd *cobra.Command) {
+			start := func(cmd *cobra.Command, args []string) error {
+				if tracing(cmd) {
+					traceStart(cmd, args, cfgs)
+				}
+				return nil
+			}
+			cmd.PreRunE, cmd.PreRun = runBefore(start, traceHook("PreRun", cmd.PreRunE, cmd.PreRun), nil), nil
+			wrapRun(cmd, func(next runFunc) runFunc {
+				return traceHook("Run", next, nil)
+			})
+			cmd.PostRunE, cmd.PostRun = traceHook("PostRun", cmd.PostRunE, cmd.PostRun), nil
+		})
+	})
+	return b
+}
+
+// tracing returns whether cmd is being executed with --trace.
+func tracing(cmd *cobra.Command) bool {
+	on, _ := cmd.Flags().GetBool(TraceFlagName)
+	return on
+}
+
+// traceStart traces the command being executed, its args and flags and the
+// sources of each of cfgs.
+func traceStart(cmd *cobra.Command, args []string, cfgs []*ViperCfgBuilder) {
+	w := cmd.ErrOrStderr()
+	tracef(w, "command %s, args %q", cmd.CommandPath(), args)
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		tracef(w, "flag --%s=%s (changed: %t)", f.Name, flagValue(f), f.Changed)
+	})
+	for _, cfg := range cfgs {
+		cfg.traceSources(w)
+	}
+}
+
+// secretFlagWords are the words of a flag name that mark its value as a
+// secret.
+var secretFlagWords = []string{"password", "passwd", "secret", "token", "key", "apikey", "credential", "credentials"}
+
+// flagValue returns the value of f to report, or redacted if the name of f
+// looks like it holds a secret.
+func flagValue(f *pflag.Flag) string {
+	for _, word := range strings.FieldsFunc(strings.ToLower(f.Name), func(r rune) bool {
+		return r == '-' || r == '_' || r == '.'
+	}) {
+		if contains(secretFlagWords, word) {
+			return redacted
+		}
+	}
+	return f.Value.String()
+}
+
+// traceHook returns a function that runs hookE or hook, whichever is set,
+// tracing its start and end when the command is being traced, and nil when
+// neither is set.
+func traceHook(name string, hookE runFunc, hook func(cmd *cobra.Command, args []string)) runFunc {
+	if hookE == nil && hook == nil {
+		return nil
+	}
+	if hookE == nil {
+		hookE = func(cmd *cobra.Command, args []string) error {
+			hook(cmd, args)
+			return nil
+		}
+	}
+	return func(cmd *cobra.Command, args []string) error {
+		if !tracing(cmd) {
+			return hookE(cmd, args)
+		}
+		w := cmd.ErrOrStderr()
+		tracef(w, "%s start", name)
+		if err := hookE(cmd, args); err != nil {
+			tracef(w, "%s end, error: %v", name, err)
+			return err
+		}
+		tracef(w, "%s end", name)
+		return nil
+	}
+}
+
+// traceSources traces the config file read and the layer each key came from.
+func (b *ViperCfgBuilder) traceSources(w io.Writer) {
+	if file := b.cfg.ConfigFileUsed(); file != "" {
+		tracef(w, "config file %s", file)
+	}
+	for _, file := range b.configFiles {
+		tracef(w, "config file %s", file)
+	}
+	layers := b.layers()
+	keys := b.cfg.AllKeys()
+	sort.Strings(keys)
+	for _, k := range keys {
+		tracef(w, "config key %s from %s", k, source(layers, k))
+	}
+}
+
+// tracef writes a trace line to w.
+func tracef(w io.Writer, format string, a ...any) {
+	fmt.Fprintf(w, "[trace] "+format+"\n", a...)
+}
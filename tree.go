@@ -0,0 +1,28 @@
+package boa
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// PrintTree writes the command's hierarchy of available subcommands to w as
+// an indented tree, along with each command's short description, giving a
+// quick overview of the CLI's structure.
+func (c Command) PrintTree(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 3, 3, 3, ' ', 0)
+	printTree(tw, c.Command, 0)
+	return tw.Flush()
+}
+
+func printTree(w io.Writer, cmd *cobra.Command, depth int) {
+	fmt.Fprintf(w, "%s%s\t%s\n", strings.Repeat("  ", depth), cmd.Name(), cmd.Short)
+	for _, sub := range cmd.Commands() {
+		if sub.IsAvailableCommand() {
+			printTree(w, sub, depth+1)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package boa
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// typedValue is a flag value of any type, parsed by a function.
+type typedValue[T any] struct {
+	value *T
+	parse func(string) (T, error)
+}
+
+func (v *typedValue[T]) Set(s string) error {
+	parsed, err := v.parse(s)
+	if err != nil {
+		return err
+	}
+	*v.value = parsed
+	return nil
+}
+
+func (v *typedValue[T]) String() string {
+	rv := reflect.ValueOf(v.value).Elem()
+	if (rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface) && rv.IsNil() {
+		return ""
+	}
+	return fmt.Sprint(*v.value)
+}
+
+// Type returns the name of T, less any pointers, e.g. "address" for
+// *mail.Address.
+func (v *typedValue[T]) Type() string {
+	t := reflect.TypeOf(v.value).Elem()
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Name() == "" {
+		return "value"
+	}
+	return strings.ToLower(t.Name())
+}
+
+// WithTypedFlag defines a flag of any type T on the command built by b, with
+// specified name, default value, and usage string. Values are parsed with
+// parse, so arbitrary types can be used as flags without a bespoke builder
+// method, e.g.
+//
+//	boa.WithTypedFlag(b, "from", nil, "sender address", mail.ParseAddress)
+//
+// Methods can't have type parameters, so this is a function taking the
+// builder rather than a builder method. It returns b, so the fluent chain can
+// continue from its result. The value can be retrieved with GetTyped.
+func WithTypedFlag[T any](b *CobraCmdBuilder, name string, value T, usage string, parse func(string) (T, error)) *CobraCmdBuilder {
+	return WithTypedVarFlag(b, new(T), name, value, usage, parse)
+}
+
+// WithTypedVarFlag is like WithTypedFlag, but stores the value of the flag in
+// variable.
+func WithTypedVarFlag[T any](b *CobraCmdBuilder, variable *T, name string, value T, usage string, parse func(string) (T, error)) *CobraCmdBuilder {
+	*variable = value
+	b.cmd.Flags().Var(&typedValue[T]{value: variable, parse: parse}, name, usage)
+	return b
+}
+
+// GetTyped returns the value of the flag called name in flags, which must
+// have been defined with WithTypedFlag or WithTypedVarFlag for the type T.
+func GetTyped[T any](flags *pflag.FlagSet, name string) (T, error) {
+	var zero T
+	f := flags.Lookup(name)
+	if f == nil {
+		return zero, fmt.Errorf("flag accessed but not defined: %s", name)
+	}
+	v, ok := f.Value.(*typedValue[T])
+	if !ok {
+		return zero, fmt.Errorf("trying to get %T value of flag of type %s", zero, f.Value.Type())
+	}
+	return *v.value, nil
+}
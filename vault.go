@@ -0,0 +1,208 @@
+package boa
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// vaultTimeout is how long a request to Vault may take when NewVaultClient
+// isn't given a client of its own.
+const vaultTimeout = 10 * time.Second
+
+var (
+	// ErrVaultSecretNotFound is returned when a Vault secret doesn't exist.
+	ErrVaultSecretNotFound = errors.New("vault secret not found")
+	// ErrVaultPermissionDenied is returned when the Vault token is invalid or
+	// isn't allowed to read a secret.
+	ErrVaultPermissionDenied = errors.New("vault permission denied")
+)
+
+// VaultClient reads secrets from HashiCorp Vault.
+type VaultClient interface {
+	// ReadSecret returns the key/values of the secret at path.
+	ReadSecret(path string) (map[string]any, error)
+}
+
+// vaultClient is a VaultClient using Vault's HTTP API.
+type vaultClient struct {
+	addr   string
+	token  string
+	client *http.Client
+}
+
+// NewVaultClient returns a VaultClient for the Vault server at addr, e.g.
+// https://vault.example.com:8200, that authenticates with token and sends its
+// requests with client. If client is nil, requests are sent with a client that
+// gives up after 10 seconds, so that an unresponsive server can't block
+// startup.
+func NewVaultClient(addr string, token string, client *http.Client) VaultClient {
+	if client == nil {
+		client = &http.Client{Timeout: vaultTimeout}
+	}
+	return &vaultClient{addr: strings.TrimSuffix(addr, "/"), token: token, client: client}
+}
+
+// ReadSecret returns the key/values of the secret at path, unwrapping the
+// data of KV version 2 secrets.
+func (c *vaultClient) ReadSecret(path string) (map[string]any, error) {
+	req, err := http.NewRequest(http.MethodGet, c.addr+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", c.token)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrVaultSecretNotFound
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return nil, ErrVaultPermissionDenied
+	default:
+		return nil, fmt.Errorf("unexpected vault response %s", resp.Status)
+	}
+	var secret struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return nil, fmt.Errorf("decoding vault response: %w", err)
+	}
+	if data, ok := secret.Data["data"].(map[string]any); ok {
+		if _, ok := secret.Data["metadata"]; ok {
+			return data, nil
+		}
+	}
+	return secret.Data, nil
+}
+
+// WithVaultProvider reads the secret at path from the Vault server at addr,
+// authenticating with token, and adds its key/values to the config, as with
+// WithVaultClient.
+//
+// If an error is encountered, logs fatal
+func (b *ViperCfgBuilder) WithVaultProvider(addr string, path string, token string) *ViperCfgBuilder {
+	return b.WithVaultClient(NewVaultClient(addr, token, nil), path)
+}
+
+// TryWithVaultProvider is like WithVaultProvider, but returns the error
+// reading the secret rather than logging fatal.
+func (b *ViperCfgBuilder) TryWithVaultProvider(addr string, path string, token string) (*ViperCfgBuilder, error) {
+	return b.TryWithVaultClient(NewVaultClient(addr, token, nil), path)
+}
+
+// WithVaultClient reads the secret at path with client and adds its
+// key/values to the config in a vault layer, which takes precedence over the
+// config file but not env vars or flags. The secret is read once and added
+// again whenever the config is read.
+//
+// Secret values are kept out of anything that writes or reports the config:
+// they aren't written by WriteConfig, WriteConfigAs or SafeWriteConfigAs, and
+// are redacted by DumpConfig and LayerReport.
+//
+// If an error is encountered, logs fatal
+func (b *ViperCfgBuilder) WithVaultClient(client VaultClient, path string) *ViperCfgBuilder {
+	if _, err := b.TryWithVaultClient(client, path); err != nil {
+		log.Fatalf("Error reading vault secret: %v", err)
+	}
+	return b
+}
+
+// TryWithVaultClient is like WithVaultClient, but returns the error reading
+// the secret rather than logging fatal. Errors wrap ErrVaultSecretNotFound or
+// ErrVaultPermissionDenied when the secret doesn't exist or can't be read
+// with the token.
+func (b *ViperCfgBuilder) TryWithVaultClient(client VaultClient, path string) (*ViperCfgBuilder, error) {
+	secret, err := client.ReadSecret(path)
+	if err != nil {
+		return b, fmt.Errorf("reading vault secret %q: %w", path, err)
+	}
+	b.secrets = append(b.secrets, secret)
+	return b, b.cfg.MergeConfigMap(secret)
+}
+
+// mergeSecrets merges the secrets read from Vault into the config.
+func (b *ViperCfgBuilder) mergeSecrets() error {
+	for _, secret := range b.secrets {
+		if err := b.cfg.MergeConfigMap(secret); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// secretValue returns the value of key in the secrets read from Vault, later
+// secrets taking precedence over earlier ones.
+func (b *ViperCfgBuilder) secretValue(key string) (any, bool) {
+	for i := len(b.secrets) - 1; i >= 0; i-- {
+		if v, ok := nestedValue(b.secrets[i], key); ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// isSecret returns whether the value of key is a secret that mustn't be
+// written or reported.
+func (b *ViperCfgBuilder) isSecret(key string) bool {
+	if _, ok := b.decrypted[key]; ok {
+		return true
+	}
+	_, ok := b.secretValue(key)
+	return ok
+}
+
+// nestedValue returns the value of the dot delimited key in m, matching the
+// keys of m regardless of case as viper does.
+func nestedValue(m map[string]any, key string) (any, bool) {
+	path := strings.Split(key, ".")
+	var v any = m
+	for _, name := range path {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		v, ok = nil, false
+		for k, child := range m {
+			if strings.EqualFold(k, name) {
+				v, ok = child, true
+				break
+			}
+		}
+		if !ok {
+			return nil, false
+		}
+	}
+	if _, ok := v.(map[string]any); ok {
+		return nil, false
+	}
+	return v, true
+}
+
+// deleteNested deletes the dot delimited key from m, along with any maps
+// left empty by deleting it.
+func deleteNested(m map[string]any, key string) {
+	deletePath(m, strings.Split(key, "."))
+}
+
+func deletePath(m map[string]any, path []string) {
+	if len(path) == 1 {
+		delete(m, path[0])
+		return
+	}
+	child, ok := m[path[0]].(map[string]any)
+	if !ok {
+		return
+	}
+	deletePath(child, path[1:])
+	if len(child) == 0 {
+		delete(m, path[0])
+	}
+}
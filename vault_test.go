@@ -0,0 +1,84 @@
+package boa
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithVaultProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/app":
+			w.Write([]byte(`{"data": {"data": {"db": {"password": "hunter2"}, "api_key": "abc"}, "metadata": {"version": 1}}}`))
+		case "/v1/kv/app":
+			w.Write([]byte(`{"data": {"api_key": "v1"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	b := NewViperCfg().
+		WithConfigType("yaml").
+		ReadConfig(strings.NewReader("api_key: file\ndb:\n  host: localhost")).
+		WithVaultProvider(server.URL, "secret/data/app", "token")
+	cfg := b.Build()
+	assert.Equal(t, "hunter2", cfg.GetString("db.password"))
+	assert.Equal(t, "localhost", cfg.GetString("db.host"))
+	assert.Equal(t, "abc", cfg.GetString("api_key"))
+
+	b.ReadConfig(strings.NewReader("api_key: file"))
+	assert.Equal(t, "abc", cfg.GetString("api_key"))
+
+	b, err := NewViperCfg().TryWithVaultProvider(server.URL, "kv/app", "token")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", b.Build().GetString("api_key"))
+
+	_, err = NewViperCfg().TryWithVaultProvider(server.URL, "secret/data/missing", "token")
+	assert.ErrorIs(t, err, ErrVaultSecretNotFound)
+	assert.EqualError(t, err, `reading vault secret "secret/data/missing": vault secret not found`)
+
+	_, err = NewViperCfg().TryWithVaultProvider(server.URL, "secret/data/app", "wrong")
+	assert.ErrorIs(t, err, ErrVaultPermissionDenied)
+
+	assert.Equal(t, vaultTimeout, NewVaultClient(server.URL, "token", nil).(*vaultClient).client.Timeout)
+}
+
+func TestWithVaultProviderKeepsSecretsOut(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data": {"db": {"password": "hunter2"}}}`))
+	}))
+	defer server.Close()
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte("db:\n  host: localhost"), 0o600))
+
+	b := NewViperCfg().
+		WithConfigFiles(file).
+		ReadInConfig().
+		WithVaultProvider(server.URL, "kv/app", "token")
+	assert.Equal(t, "hunter2", b.Build().GetString("db.password"))
+
+	_, err := b.WriteConfig()
+	assert.NoError(t, err)
+	data, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, "db:\n    host: localhost\n", string(data))
+	assert.Equal(t, "hunter2", b.Build().GetString("db.password"))
+
+	dump := new(bytes.Buffer)
+	assert.NoError(t, b.DumpConfig(dump))
+	assert.Equal(t, "db:\n  host: localhost # from file\n  password: '[redacted]' # from vault\n", dump.String())
+	assert.NotContains(t, b.LayerReport(), "hunter2")
+	assert.Contains(t, b.LayerReport(), "db.password   -     [redacted]   -           -         vault\n")
+}
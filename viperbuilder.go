@@ -1,31 +1,99 @@
 package boa
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/adrg/xdg"
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
 // ViperCfgBuilder is a builder that wraps viper.Viper objects to allow more
 // fluently defining configuration.
 type ViperCfgBuilder struct {
-	cfg *viper.Viper
+	cfg                *viper.Viper
+	readTimeout        time.Duration
+	requiredKeys       []string
+	configType         string
+	sources            []configSource
+	rebuildable        bool
+	configFile         string
+	defaults           map[string]any
+	structDefaults     map[string]any
+	defaultsPrecedence DefaultsPrecedence
+	envPrefix          string
+	envReplacer        *strings.Replacer
+	automaticEnv       bool
+	boundEnvs          map[string][]string
+	strictMode         StrictMode
+	deprecatedKeys     [][2]string
+	overrides          map[string]any
+	profile            string
+	multiDocument      bool
+	partialRead        bool
+	sectionErrors      []SectionError
+	interpolation      bool
+	transforms         []valueTransform
+	configName         string
+	configPaths        []string
+	configFiles        []string
+	mergeFiles         []string
+	pathsReordered     bool
+	envOnly            bool
+	lockWrites         bool
+	lockTimeout        time.Duration
+	restartKeys        []string
+	reloadMu           sync.RWMutex
+	configDirs         []string
+	reloadFuncs        []func(changed []string)
+	boundFlags         map[string]*pflag.Flag
+	onChange           []func(fsnotify.Event)
+	watching           bool
+	templating         bool
+	templateData       any
+	secrets            []map[string]any
+	readStart          time.Time
+	stats              ConfigStats
+	statsFuncs         []func(ConfigStats)
+	partialUnmarshal   bool
+	decryptors         []valueDecryptor
+	decrypted          map[string]decryptedValue
 }
 
+// ErrReadTimeout is returned when reading configuration takes longer than the
+// duration given to WithReadTimeout.
+var ErrReadTimeout = errors.New("timed out reading config")
+
+// ErrNoConfigFile is returned when writing back to the config file but none
+// was read in or set.
+var ErrNoConfigFile = errors.New("no config file to write")
+
 // ToViperCfgBuilder is used to convert a viper.Viper object to a
 // ViperCfgBuilder
+//
+// Config that was read into cmd before it was converted isn't known to the
+// builder, so it's processed where it is rather than rebuilt from what was
+// read, until config is read through the builder.
 func ToViperCfgBuilder(cmd *viper.Viper) *ViperCfgBuilder {
-	return &ViperCfgBuilder{cmd}
+	return &ViperCfgBuilder{cfg: cmd}
 }
 
 // NewViperCfg initializes a new viper instance and returns a builder.
 func NewViperCfg() *ViperCfgBuilder {
 	return &ViperCfgBuilder{
-		cfg: viper.New(),
+		cfg:         viper.New(),
+		rebuildable: true,
 	}
 }
 
@@ -33,26 +101,63 @@ func NewViperCfg() *ViperCfgBuilder {
 // configuration and returns a builder. It adds the user's current working
 // directory and XDG_CONFIG_HOME to the searchable config path in that
 // respective order and searches for configuration files of 'name' and any
-// extension.
+// extension. A warning is logged if a config file is found but can't be read.
 func NewDefaultViperCfg(name string) *ViperCfgBuilder {
-	cwd, err := os.Getwd()
-	if err != nil {
+	b, err := NewDefaultViperCfgE(name)
+	if b == nil {
 		log.Fatal(err)
 	}
-	b := &ViperCfgBuilder{
-		cfg: viper.New(),
+	if err != nil {
+		log.Printf("Warning: error reading config: %v", err)
+	}
+	return b
+}
+
+// NewDefaultViperCfgE is like NewDefaultViperCfg, but returns the error
+// encountered reading the config file, such as a viper.ConfigParseError, along
+// with the builder. Not finding a config file isn't an error.
+func NewDefaultViperCfgE(name string) (*ViperCfgBuilder, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
 	}
+	b := NewViperCfg()
 	b.cfg.AddConfigPath(cwd)
 	b.cfg.AddConfigPath(xdg.ConfigHome + "/" + name)
 	b.cfg.SetConfigName(name)
-	b.cfg.ReadInConfig()
-	return b
+	b.configPaths = []string{cwd, xdg.ConfigHome + "/" + name}
+	b.configName = name
+	err = b.readInConfig()
+	if errors.As(err, &viper.ConfigFileNotFoundError{}) {
+		err = nil
+	}
+	return b, err
+}
+
+// EnvOnly configures viper entirely from env vars, as is common in
+// containers, so that a stray config file is never read by accident. Env vars
+// are matched automatically using prefix, with dots in keys replaced by
+// underscores, e.g. APP_DATABASE_HOST for database.host with a prefix of
+// "app". Config files and paths are ignored, including any already added or
+// read, and ReadInConfig doesn't read any file, though it still validates
+// the configuration. Everything else set on the viper instance, such as
+// defaults, overrides and bound flags and env vars, is kept, though viper
+// still reports a config file read before this as ConfigFileUsed.
+func (b *ViperCfgBuilder) EnvOnly(prefix string) *ViperCfgBuilder {
+	b.envOnly = true
+	b.sources, b.rebuildable = nil, true
+	b.configFile, b.configFiles, b.configPaths = "", nil, nil
+	_ = b.loadSources(b.cfg)
+	return b.WithEnvPrefix(prefix).WithDefaultEnvKeyReplacer().WithAutomaticEnv()
 }
 
 // WithConfigFiles takes a variable number of filepaths to check for viper
 // configuration. The order of the files passed is the order of precedence
 // given to each filepath.
 func (b *ViperCfgBuilder) WithConfigFiles(files ...string) *ViperCfgBuilder {
+	if b.envOnly {
+		return b
+	}
 	for _, f := range files {
 		if exists(f) {
 			b.cfg.SetConfigFile(f)
@@ -65,17 +170,59 @@ func (b *ViperCfgBuilder) WithConfigFiles(files ...string) *ViperCfgBuilder {
 // WithConfigPaths adds a variable number of paths for Viper to search for the
 // config file in. It will only add the path if it exists.
 func (b *ViperCfgBuilder) WithConfigPaths(paths ...string) *ViperCfgBuilder {
+	if b.envOnly {
+		return b
+	}
 	for _, p := range paths {
 		if exists(p) {
 			b.cfg.AddConfigPath(p)
+			b.configPaths = append(b.configPaths, p)
 		}
 	}
 	return b
 }
 
+// PrependConfigPath adds a path for Viper to search for the config file in,
+// ahead of every path added before it. This lets a path added late, such as
+// one given by a --config-dir flag, take precedence over the defaults. It
+// will only add the path if it exists.
+func (b *ViperCfgBuilder) PrependConfigPath(path string) *ViperCfgBuilder {
+	if exists(path) && !b.envOnly {
+		b.configPaths = append([]string{path}, b.configPaths...)
+		b.pathsReordered = true
+	}
+	return b
+}
+
+// ReorderConfigPaths moves the given config paths to the front of the search
+// order, in the order given. Any other paths keep their relative order after
+// them, and paths that weren't added are ignored.
+func (b *ViperCfgBuilder) ReorderConfigPaths(paths ...string) *ViperCfgBuilder {
+	added, moved := map[string]bool{}, map[string]bool{}
+	for _, p := range b.configPaths {
+		added[p] = true
+	}
+	var order []string
+	for _, p := range paths {
+		if added[p] && !moved[p] {
+			moved[p] = true
+			order = append(order, p)
+		}
+	}
+	for _, p := range b.configPaths {
+		if !moved[p] {
+			order = append(order, p)
+		}
+	}
+	b.configPaths = order
+	b.pathsReordered = true
+	return b
+}
+
 // WithConfigName sets the config name to search for in the configured paths.
 func (b *ViperCfgBuilder) WithConfigName(name string) *ViperCfgBuilder {
 	b.cfg.SetConfigName(name)
+	b.configName = name
 	return b
 }
 
@@ -83,12 +230,63 @@ func (b *ViperCfgBuilder) WithConfigName(name string) *ViperCfgBuilder {
 // e.g. "json"
 func (b *ViperCfgBuilder) WithConfigType(ext string) *ViperCfgBuilder {
 	b.cfg.SetConfigType(ext)
+	b.configType = ext
+	return b
+}
+
+// WithDefault sets the default value for a key. Defaults have the lowest
+// precedence, so they are only used when no other source sets the key.
+func (b *ViperCfgBuilder) WithDefault(key string, value any) *ViperCfgBuilder {
+	if b.defaults == nil {
+		b.defaults = map[string]any{}
+	}
+	b.defaults[strings.ToLower(key)] = value
+	b.applyDefaults()
+	return b
+}
+
+// WithDefaults sets the default value for each key in defaults, as with
+// WithDefault.
+func (b *ViperCfgBuilder) WithDefaults(defaults map[string]any) *ViperCfgBuilder {
+	for k, v := range defaults {
+		b.WithDefault(k, v)
+	}
+	return b
+}
+
+// WithBoundPFlag binds a config key to a flag, so that the flag's value is
+// used for the key when the flag is set on the command line. A flag that was
+// set takes precedence over env vars, the config file and defaults, while
+// values set with viper's Set take precedence over it. A flag that wasn't set
+// only supplies its default when no other source sets the key.
+//
+// If the flag is nil, logs fatal
+func (b *ViperCfgBuilder) WithBoundPFlag(key string, flag *pflag.Flag) *ViperCfgBuilder {
+	if err := b.cfg.BindPFlag(key, flag); err != nil {
+		log.Fatalf("Error binding flag: %v", err)
+	}
+	if b.boundFlags == nil {
+		b.boundFlags = map[string]*pflag.Flag{}
+	}
+	b.boundFlags[strings.ToLower(key)] = flag
+	return b
+}
+
+// WithBoundPFlags binds every flag in set to the config key of the same
+// name, as with WithBoundPFlag. This lets the flags of a command built with a
+// CobraCmdBuilder be wired in at once, e.g.
+// WithBoundPFlags(cmd.Flags()).
+func (b *ViperCfgBuilder) WithBoundPFlags(set *pflag.FlagSet) *ViperCfgBuilder {
+	set.VisitAll(func(f *pflag.Flag) {
+		b.WithBoundPFlag(f.Name, f)
+	})
 	return b
 }
 
 // WithEnvPrefix sets the prefix to use for subsequent bound env vars.
 func (b *ViperCfgBuilder) WithEnvPrefix(prefix string) *ViperCfgBuilder {
 	b.cfg.SetEnvPrefix(prefix)
+	b.envPrefix = prefix
 	return b
 }
 
@@ -99,6 +297,18 @@ func (b *ViperCfgBuilder) WithEnvPrefix(prefix string) *ViperCfgBuilder {
 // EnvPrefix will be used when set when env name is not provided.
 func (b *ViperCfgBuilder) WithBoundEnv(input ...string) *ViperCfgBuilder {
 	b.cfg.BindEnv(input...)
+	if len(input) == 0 {
+		return b
+	}
+	if b.boundEnvs == nil {
+		b.boundEnvs = map[string][]string{}
+	}
+	key := strings.ToLower(input[0])
+	if len(input) == 1 {
+		b.boundEnvs[key] = append(b.boundEnvs[key], b.envName(key))
+	} else {
+		b.boundEnvs[key] = append(b.boundEnvs[key], input[1:]...)
+	}
 	return b
 }
 
@@ -106,6 +316,7 @@ func (b *ViperCfgBuilder) WithBoundEnv(input ...string) *ViperCfgBuilder {
 // (config, default or flags). If matching env vars are found, they are loaded into Viper.
 func (b *ViperCfgBuilder) WithAutomaticEnv() *ViperCfgBuilder {
 	b.cfg.AutomaticEnv()
+	b.automaticEnv = true
 	return b
 }
 
@@ -114,6 +325,7 @@ func (b *ViperCfgBuilder) WithAutomaticEnv() *ViperCfgBuilder {
 // not match it.
 func (b *ViperCfgBuilder) WithEnvKeyReplacer(replacer *strings.Replacer) *ViperCfgBuilder {
 	b.cfg.SetEnvKeyReplacer(replacer)
+	b.envReplacer = replacer
 	return b
 }
 
@@ -123,7 +335,60 @@ func (b *ViperCfgBuilder) WithEnvKeyReplacer(replacer *strings.Replacer) *ViperC
 // For example, the env var COMMAND_NAME can be referenced through Viper as
 // viper.Get("command.name")
 func (b *ViperCfgBuilder) WithDefaultEnvKeyReplacer() *ViperCfgBuilder {
-	b.cfg.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	return b.WithEnvKeyReplacer(strings.NewReplacer(".", "_"))
+}
+
+// WithRequiredKeys marks keys that must be set once the configuration has been
+// read, whether by a config file, env var, flag or default. ReadConfig and
+// ReadInConfig fail with a MissingKeysError naming any that are not.
+func (b *ViperCfgBuilder) WithRequiredKeys(keys ...string) *ViperCfgBuilder {
+	b.requiredKeys = append(b.requiredKeys, keys...)
+	return b
+}
+
+// WithMultiDocument makes a YAML config file containing multiple documents,
+// separated by "---", read as a whole rather than stopping after the first
+// document. Each subsequent document is merged on top of the ones before it.
+// When several config files are read or merged, each is split into its
+// documents on its own, before the files of higher precedence are merged.
+func (b *ViperCfgBuilder) WithMultiDocument() *ViperCfgBuilder {
+	b.multiDocument = true
+	return b
+}
+
+// WithDeprecatedKey renames the config key oldKey to newKey. Once the
+// configuration has been read, if the config file still sets oldKey, a
+// deprecation warning is logged and its value is used for newKey, unless the
+// config file sets newKey too.
+func (b *ViperCfgBuilder) WithDeprecatedKey(oldKey string, newKey string) *ViperCfgBuilder {
+	b.deprecatedKeys = append(b.deprecatedKeys, [2]string{oldKey, newKey})
+	return b
+}
+
+// WithValueTransform normalizes the value of key once the configuration has
+// been read, such as to expand a path or lowercase an enum, by setting it to
+// the result of transform. Multiple transforms of the same key run in the
+// order they were added. Transforms are skipped for keys that aren't set,
+// and reading fails if a transform returns an error.
+//
+// The raw value is transformed each time the config is processed, such as
+// when more config is merged in or a profile is selected, and the result
+// replaces it in the config read from files. Values set by env vars, bound
+// flags or overrides aren't transformed and still take precedence.
+func (b *ViperCfgBuilder) WithValueTransform(key string, transform func(any) (any, error)) *ViperCfgBuilder {
+	b.transforms = append(b.transforms, valueTransform{key, transform})
+	return b
+}
+
+// WithReadTimeout limits how long ReadConfig and ReadInConfig may take before
+// giving up with ErrReadTimeout. This keeps a CLI from hanging at startup on
+// slow or stale filesystems, such as an unresponsive network mount.
+//
+// Only reading the raw config is subject to the timeout. It's parsed once it
+// has been read, so a read that times out is cancelled and leaves the config
+// as it was.
+func (b *ViperCfgBuilder) WithReadTimeout(d time.Duration) *ViperCfgBuilder {
+	b.readTimeout = d
 	return b
 }
 
@@ -132,27 +397,84 @@ func (b *ViperCfgBuilder) WithDefaultEnvKeyReplacer() *ViperCfgBuilder {
 //
 // If an error is encountered, logs fatal
 func (b *ViperCfgBuilder) ReadConfig(in io.Reader) *ViperCfgBuilder {
-	err := b.cfg.ReadConfig(in)
-	if err != nil {
+	if _, err := b.TryReadConfig(in); err != nil {
 		log.Fatalf("Error reading config: %v", err)
 	}
 	return b
 }
 
+// TryReadConfig is like ReadConfig, but returns viper's error rather than
+// logging fatal, so that it can be used by long-running programs.
+func (b *ViperCfgBuilder) TryReadConfig(in io.Reader) (*ViperCfgBuilder, error) {
+	return b, b.readConfig(in)
+}
+
 // ReadInConfig will discover and load the configuration file from disk
 // and key/value stores, searching in one of the defined paths.
 //
 // If an error is encountered, logs fatal
 func (b *ViperCfgBuilder) ReadInConfig() *ViperCfgBuilder {
-	err := b.cfg.ReadInConfig()
-	if err != nil {
+	if _, err := b.TryReadInConfig(); err != nil {
 		log.Fatalf("Error reading in config: %v", err)
 	}
 	return b
 }
 
-// Build returns a viper.Viper object from a ViperCfgBuilder
+// TryReadInConfig is like ReadInConfig, but returns viper's error rather than
+// logging fatal, so that it can be used by long-running programs. Callers can
+// tell an absent config file from a malformed one with errors.As: a
+// viper.ConfigFileNotFoundError is returned when no config file is found in
+// the config paths, and a viper.ConfigParseError when it can't be parsed. A
+// config file set explicitly that doesn't exist gives an error matching
+// fs.ErrNotExist instead.
+func (b *ViperCfgBuilder) TryReadInConfig() (*ViperCfgBuilder, error) {
+	return b, b.readInConfig()
+}
+
+// WriteConfig writes the current configuration back to the config file that
+// was read in, or set, overwriting it. ErrNoConfigFile is returned if there's
+// no such file.
+func (b *ViperCfgBuilder) WriteConfig() (*ViperCfgBuilder, error) {
+	path := b.configFilePath()
+	if path == "" {
+		return b, ErrNoConfigFile
+	}
+	return b.WriteConfigAs(path)
+}
+
+// WriteConfigAs writes the current configuration to the file at path,
+// overwriting it if it exists.
+func (b *ViperCfgBuilder) WriteConfigAs(path string) (*ViperCfgBuilder, error) {
+	return b, b.writeLocked(path, func() error {
+		w, err := b.writableConfig()
+		if err != nil {
+			return err
+		}
+		return w.WriteConfigAs(path)
+	})
+}
+
+// SafeWriteConfigAs writes the current configuration to the file at path,
+// failing rather than overwriting it if it exists.
+func (b *ViperCfgBuilder) SafeWriteConfigAs(path string) (*ViperCfgBuilder, error) {
+	err := b.writeLocked(path, func() error {
+		w, err := b.writableConfig()
+		if err != nil {
+			return err
+		}
+		return w.SafeWriteConfigAs(path)
+	})
+	var exists viper.ConfigFileAlreadyExistsError
+	if errors.As(err, &exists) {
+		return b, fmt.Errorf("refusing to overwrite existing config file %s: %w", path, err)
+	}
+	return b, err
+}
+
+// Build returns a viper.Viper object from a ViperCfgBuilder, starting to
+// watch the config file if WithWatch was used.
 func (b *ViperCfgBuilder) Build() *viper.Viper {
+	b.watch()
 	return b.cfg
 }
 
@@ -164,6 +486,350 @@ func (b *ViperCfgBuilder) ReadInConfigAndBuild() *viper.Viper {
 	return b.ReadInConfig().Build()
 }
 
+func (b *ViperCfgBuilder) readConfig(in io.Reader) error {
+	data, err := b.readTimed(func(ctx context.Context) ([][]byte, error) {
+		data, err := readAllContext(ctx, in)
+		return [][]byte{data}, err
+	})
+	if err != nil {
+		return err
+	}
+	sources := []configSource{{data: data[0]}}
+	if err := b.checkSources(sources); err != nil {
+		return err
+	}
+	b.sources, b.rebuildable = sources, true
+	b.configFile, b.configFiles = "", nil
+	return b.afterRead()
+}
+
+func (b *ViperCfgBuilder) readInConfig() error {
+	if b.envOnly {
+		b.sources, b.rebuildable = nil, true
+		return b.afterRead()
+	}
+	file, err := b.configFileToRead()
+	if err != nil {
+		return err
+	}
+	if ext := b.sourceType(file); !contains(viper.SupportedExts, ext) {
+		return viper.UnsupportedConfigError(ext)
+	}
+	data, err := b.readTimed(func(ctx context.Context) ([][]byte, error) {
+		data, err := readFileContext(ctx, file)
+		return [][]byte{data}, err
+	})
+	if err != nil {
+		return err
+	}
+	sources := []configSource{{file, data[0]}}
+	if err := b.checkSources(sources); err != nil {
+		return err
+	}
+	b.cfg.SetConfigFile(file)
+	b.sources, b.rebuildable = sources, true
+	b.configFile, b.configFiles = file, nil
+	return b.afterRead()
+}
+
+// configFileToRead returns the config file that ReadInConfig reads: the one
+// set, or else the first one found in the config paths.
+func (b *ViperCfgBuilder) configFileToRead() (string, error) {
+	if file := b.cfg.ConfigFileUsed(); file != "" && !b.pathsReordered {
+		return file, nil
+	}
+	if files := b.FindConfigFiles(); len(files) > 0 {
+		return files[0], nil
+	}
+	// viper may have been given paths the builder doesn't know about, and
+	// reports a missing config file in its own terms.
+	if err := b.cfg.ReadInConfig(); err != nil {
+		return "", err
+	}
+	return b.cfg.ConfigFileUsed(), nil
+}
+
+// configSource is the raw contents of a config read into the config file
+// layer, kept so that the layer can be rebuilt from what was read rather
+// than processed again on top of values that already were.
+type configSource struct {
+	// file is the file the config was read from, or empty if it was read
+	// from a reader.
+	file string
+	data []byte
+}
+
+// sourceType returns the format of the config read from file, or from a
+// reader if file is empty.
+func (b *ViperCfgBuilder) sourceType(file string) string {
+	if b.configType != "" {
+		return b.configType
+	}
+	if file == "" {
+		file = b.cfg.ConfigFileUsed()
+	}
+	return strings.TrimPrefix(filepath.Ext(file), ".")
+}
+
+// checkSources parses each of sources, so that a config that can't be parsed
+// is rejected before it replaces the config read. With WithPartialRead, a
+// source that can't be parsed is replaced by its valid sections instead.
+func (b *ViperCfgBuilder) checkSources(sources []configSource) error {
+	for i, src := range sources {
+		ext := b.sourceType(src.file)
+		v := viper.New()
+		v.SetConfigType(ext)
+		if err := v.ReadConfig(bytes.NewReader(src.data)); err != nil {
+			data, err := b.readPartial(src.data, ext, err)
+			if err != nil {
+				return err
+			}
+			sources[i].data = data
+		}
+	}
+	return nil
+}
+
+// loadSources replaces the config file layer of v with the sources read,
+// merging them from the lowest precedence to the highest, along with the
+// documents of each after its first with WithMultiDocument.
+func (b *ViperCfgBuilder) loadSources(v *viper.Viper) error {
+	// Reading nothing clears the config already read in. It fails for
+	// formats such as JSON that can't be empty, but only once the config
+	// has been cleared.
+	_ = v.ReadConfig(strings.NewReader(""))
+	for _, src := range b.sources {
+		if src.file != "" {
+			v.SetConfigFile(src.file)
+		}
+		if err := v.MergeConfig(bytes.NewReader(src.data)); err != nil {
+			return err
+		}
+		if err := b.mergeDocuments(v, src); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writableConfig returns a copy of the configuration to write to a file, in
+// which secrets read from Vault are left out and decrypted values are
+// encrypted again, so that they're never written in plaintext.
+func (b *ViperCfgBuilder) writableConfig() (*viper.Viper, error) {
+	settings := b.cfg.AllSettings()
+	for _, k := range b.cfg.AllKeys() {
+		if b.isSecret(k) {
+			deleteNested(settings, k)
+		}
+	}
+	w := viper.New()
+	if b.configType != "" {
+		w.SetConfigType(b.configType)
+	}
+	if err := w.MergeConfigMap(settings); err != nil {
+		return nil, err
+	}
+	for k, v := range b.decrypted {
+		if err := w.MergeConfigMap(nestedMap(k, v.encrypted)); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// configFilePath returns the path of the config file that was read in, or
+// set, and an empty string if there isn't one.
+func (b *ViperCfgBuilder) configFilePath() string {
+	if path := b.cfg.ConfigFileUsed(); path != "" {
+		return path
+	}
+	return b.configFile
+}
+
+// afterRead migrates and validates the configuration once it has been read,
+// recording the stats of the read if it succeeds.
+func (b *ViperCfgBuilder) afterRead() error {
+	start := b.readStart
+	if start.IsZero() {
+		start = time.Now()
+	}
+	b.readStart = time.Time{}
+	if err := b.processRead(); err != nil {
+		return err
+	}
+	b.recordStats(time.Since(start))
+	return nil
+}
+
+// processRead rebuilds the config file layer from the sources read, then
+// migrates and validates it. Every step works from the raw sources, so
+// processing the config again, such as after merging more config into it,
+// doesn't process values that already were.
+func (b *ViperCfgBuilder) processRead() error {
+	if b.rebuildable {
+		if err := b.loadSources(b.cfg); err != nil {
+			return err
+		}
+	}
+	if err := b.mergeConfigDirs(b.cfg); err != nil {
+		return err
+	}
+	if err := b.mergeProfile(b.cfg); err != nil {
+		return err
+	}
+	if err := b.mergeSecrets(); err != nil {
+		return err
+	}
+	if err := b.decryptValues(); err != nil {
+		return err
+	}
+	if err := b.migrateDeprecatedKeys(); err != nil {
+		return err
+	}
+	if err := b.interpolateKeys(); err != nil {
+		return err
+	}
+	if err := b.renderTemplates(); err != nil {
+		return err
+	}
+	if err := b.transformValues(); err != nil {
+		return err
+	}
+	return b.checkRequiredKeys()
+}
+
+// migrateDeprecatedKeys copies the values of deprecated keys in the config
+// file to the keys that replace them.
+func (b *ViperCfgBuilder) migrateDeprecatedKeys() error {
+	for _, k := range b.deprecatedKeys {
+		oldKey, newKey := k[0], k[1]
+		if !b.cfg.InConfig(oldKey) {
+			continue
+		}
+		log.Printf("Config key %q is deprecated, use %q instead", oldKey, newKey)
+		if b.cfg.InConfig(newKey) {
+			continue
+		}
+		if err := b.cfg.MergeConfigMap(nestedMap(newKey, b.cfg.Get(oldKey))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type valueTransform struct {
+	key       string
+	transform func(any) (any, error)
+}
+
+// transformValues applies the value transforms to the keys that are set.
+func (b *ViperCfgBuilder) transformValues() error {
+	for _, t := range b.transforms {
+		if !b.cfg.IsSet(t.key) || b.setAtRuntime(t.key) {
+			continue
+		}
+		v, err := t.transform(b.cfg.Get(t.key))
+		if err != nil {
+			return fmt.Errorf("transforming config key %q: %w", t.key, err)
+		}
+		if err := b.cfg.MergeConfigMap(nestedMap(t.key, v)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nestedMap returns a map setting the dot delimited key to value.
+func nestedMap(key string, value any) map[string]any {
+	path := strings.Split(key, ".")
+	m := map[string]any{path[len(path)-1]: value}
+	for i := len(path) - 2; i >= 0; i-- {
+		m = map[string]any{path[i]: m}
+	}
+	return m
+}
+
+// readTimed runs read, which reads the raw config, giving up with
+// ErrReadTimeout if it doesn't finish within the read timeout. read is run in
+// the background and its context is cancelled when it's given up on, so it
+// must only read, leaving the config to be parsed by the caller.
+func (b *ViperCfgBuilder) readTimed(read func(ctx context.Context) ([][]byte, error)) ([][]byte, error) {
+	b.readStart = time.Now()
+	if b.readTimeout <= 0 {
+		return read(context.Background())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), b.readTimeout)
+	defer cancel()
+	type result struct {
+		data [][]byte
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		data, err := read(ctx)
+		done <- result{data, err}
+	}()
+	select {
+	case r := <-done:
+		return r.data, r.err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%w after %s", ErrReadTimeout, b.readTimeout)
+	}
+}
+
+// readAllContext reads r until EOF, stopping early if ctx is cancelled.
+func readAllContext(ctx context.Context, r io.Reader) ([]byte, error) {
+	var data bytes.Buffer
+	buf := make([]byte, 32*1024)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		n, err := r.Read(buf)
+		data.Write(buf[:n])
+		if err == io.EOF {
+			return data.Bytes(), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// readFileContext reads the file at path, stopping early if ctx is
+// cancelled.
+func readFileContext(ctx context.Context, path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readAllContext(ctx, f)
+}
+
+// MissingKeysError is returned when required keys are not set after reading
+// the configuration.
+type MissingKeysError struct {
+	Keys []string
+}
+
+func (e MissingKeysError) Error() string {
+	return "missing required config keys: " + strings.Join(e.Keys, ", ")
+}
+
+func (b *ViperCfgBuilder) checkRequiredKeys() error {
+	var missing []string
+	for _, k := range b.requiredKeys {
+		if !b.cfg.IsSet(k) {
+			missing = append(missing, k)
+		}
+	}
+	if len(missing) > 0 {
+		return MissingKeysError{Keys: missing}
+	}
+	return nil
+}
+
 func exists(path string) bool {
 	_, err := os.Stat(path)
 	if err == nil {
@@ -0,0 +1,1197 @@
+package boa
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestViperCfgBuilderReadTimeout(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+
+	b := NewViperCfg().WithConfigType("yaml").WithReadTimeout(10 * time.Millisecond)
+	err := b.readConfig(r)
+	assert.ErrorIs(t, err, ErrReadTimeout)
+	w.Write([]byte("key: late"))
+	w.Close()
+	time.Sleep(10 * time.Millisecond)
+	assert.False(t, b.Build().IsSet("key"))
+
+	b = NewViperCfg().WithConfigType("yaml").WithReadTimeout(time.Second)
+	err = b.readConfig(strings.NewReader("key: value"))
+	assert.NoError(t, err)
+	assert.Equal(t, "value", b.Build().GetString("key"))
+
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte("key: file"), 0o600))
+	b = NewViperCfg().WithConfigFiles(file).WithReadTimeout(time.Second).ReadInConfig()
+	assert.Equal(t, "file", b.Build().GetString("key"))
+	assert.Equal(t, file, b.Build().ConfigFileUsed())
+
+	_, err = NewViperCfg().WithConfigPaths(t.TempDir()).WithReadTimeout(time.Second).TryReadInConfig()
+	assert.ErrorAs(t, err, &viper.ConfigFileNotFoundError{})
+}
+
+func TestViperCfgBuilderRequiredKeysFromStruct(t *testing.T) {
+	type database struct {
+		Host string `mapstructure:"host" validate:"required"`
+		Port int    `mapstructure:"port"`
+	}
+	type config struct {
+		Name     string   `required:"true"`
+		Timeout  int      `mapstructure:"timeout"`
+		Database database `mapstructure:"database"`
+	}
+
+	b := NewViperCfg().WithConfigType("yaml").WithRequiredKeysFromStruct(config{})
+	assert.Equal(t, []string{"name", "database.host"}, b.requiredKeys)
+
+	err := b.readConfig(strings.NewReader("timeout: 5"))
+	assert.Equal(t, MissingKeysError{Keys: []string{"name", "database.host"}}, err)
+
+	err = b.readConfig(strings.NewReader("name: app\ndatabase:\n  host: localhost"))
+	assert.NoError(t, err)
+}
+
+func TestViperCfgBuilderRecursiveStruct(t *testing.T) {
+	type node struct {
+		Name     string `required:"true"`
+		Next     *node
+		Primary  struct{ Host string }
+		Replicas []string
+	}
+	n := &node{Name: "head"}
+	n.Next = n
+	b := NewViperCfg().
+		WithConfigType("yaml").
+		WithAutomaticEnv().
+		WithRequiredKeysFromStruct(node{}).
+		WithDefaultsFromStruct(n)
+	assert.Equal(t, []string{"name"}, b.requiredKeys)
+	assert.Equal(t, map[string]any{"name": "head", "primary.host": "", "replicas": []string(nil)}, b.structDefaults)
+	assert.Equal(t, []string{"name", "primary.host", "replicas"}, structKeys(reflect.TypeOf(n), "", map[reflect.Type]bool{}))
+
+	var out node
+	_, err := b.WithConfigPartialUnmarshalErrors().UnmarshalInto(&out)
+	assert.NoError(t, err)
+	assert.Equal(t, "head", out.Name)
+}
+
+func TestViperCfgBuilderLayerReport(t *testing.T) {
+	t.Setenv("APP_LOG_LEVEL", "debug")
+	b := NewViperCfg().
+		WithConfigType("yaml").
+		WithEnvPrefix("app").
+		WithDefaultEnvKeyReplacer().
+		WithAutomaticEnv().
+		WithDefault("log.level", "info").
+		WithDefault("port", 8080).
+		WithDefault("name", "default")
+	assert.NoError(t, b.readConfig(strings.NewReader("log:\n  level: warn\nname: file")))
+
+	expected := `KEY         ENV     FILE   DEFAULT   WINNER
+log.level   debug   warn   info      env
+name        -       file   default   file
+port        -       -      8080      default
+`
+	assert.Equal(t, expected, b.LayerReport())
+}
+
+func TestViperCfgBuilderDefaultsPrecedence(t *testing.T) {
+	type database struct {
+		Host string
+		Port int
+	}
+	type config struct {
+		Name     string   `mapstructure:"app_name"`
+		Database database `mapstructure:"db"`
+	}
+	defaults := config{Name: "struct", Database: database{Host: "localhost", Port: 5432}}
+
+	cfg := NewViperCfg().
+		WithDefault("app_name", "explicit").
+		WithDefaultsFromStruct(defaults).
+		Build()
+	assert.Equal(t, "explicit", cfg.GetString("app_name"))
+	assert.Equal(t, "localhost", cfg.GetString("db.host"))
+	assert.Equal(t, 5432, cfg.GetInt("db.port"))
+
+	cfg = NewViperCfg().
+		WithDefaultsPrecedence(StructDefaultsWin).
+		WithDefault("app_name", "explicit").
+		WithDefaultsFromStruct(defaults).
+		WithDefault("db.port", 3306).
+		Build()
+	assert.Equal(t, "struct", cfg.GetString("app_name"))
+	assert.Equal(t, 5432, cfg.GetInt("db.port"))
+}
+
+func TestViperCfgBuilderExportSchema(t *testing.T) {
+	type server struct {
+		Host    string
+		Port    int
+		Timeout time.Duration
+	}
+	type config struct {
+		Server server
+		Tags   []string
+	}
+	b := NewViperCfg().
+		WithDefaultsFromStruct(config{
+			Server: server{Host: "localhost", Port: 8080, Timeout: 5 * time.Second},
+			Tags:   []string{"a"},
+		}).
+		WithDefault("debug", false).
+		WithDefault("ratio", 0.5)
+
+	buf := new(bytes.Buffer)
+	assert.NoError(t, b.ExportSchema(buf))
+	expected := `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "properties": {
+    "debug": {
+      "default": false,
+      "type": "boolean"
+    },
+    "ratio": {
+      "default": 0.5,
+      "type": "number"
+    },
+    "server": {
+      "properties": {
+        "host": {
+          "default": "localhost",
+          "type": "string"
+        },
+        "port": {
+          "default": 8080,
+          "type": "integer"
+        },
+        "timeout": {
+          "default": "5s",
+          "type": "string"
+        }
+      },
+      "type": "object"
+    },
+    "tags": {
+      "default": [
+        "a"
+      ],
+      "items": {
+        "type": "string"
+      },
+      "type": "array"
+    }
+  },
+  "type": "object"
+}
+`
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestViperCfgBuilderDeprecatedKey(t *testing.T) {
+	logs := new(bytes.Buffer)
+	log.SetOutput(logs)
+	defer log.SetOutput(os.Stderr)
+
+	cfg := NewViperCfg().
+		WithConfigType("yaml").
+		WithDeprecatedKey("server.addr", "server.address").
+		WithDeprecatedKey("timeout", "server.timeout").
+		ReadConfig(strings.NewReader("server:\n  addr: localhost\n  timeout: 10s\ntimeout: 5s\n")).
+		Build()
+
+	assert.Equal(t, "localhost", cfg.GetString("server.address"))
+	assert.Equal(t, 10*time.Second, cfg.GetDuration("server.timeout"))
+	assert.Contains(t, logs.String(), `Config key "server.addr" is deprecated, use "server.address" instead`)
+	assert.Contains(t, logs.String(), `Config key "timeout" is deprecated, use "server.timeout" instead`)
+}
+
+func TestViperCfgBuilderOverrideFlag(t *testing.T) {
+	var pool, host string
+	cmd := NewCobraCmd("app").Build()
+	b := NewViperCfg().
+		WithConfigType("yaml").
+		WithOverrideFlag(cmd)
+	cfg := b.ReadConfig(strings.NewReader("database:\n  pool: 10\n  host: db")).Build()
+	ToCobraCmdBuilder(cmd).WithRunFunc(func(*cobra.Command, []string) {
+		pool, host = cfg.GetString("database.pool"), cfg.GetString("database.host")
+	})
+
+	cmd.SetArgs([]string{"--set", "database.pool=20"})
+	assert.NoError(t, cmd.Execute())
+	assert.Equal(t, "20", pool)
+	assert.Equal(t, "db", host)
+	assert.Contains(t, b.LayerReport(), "database.pool   20         -     10     -         override")
+}
+
+func TestViperCfgBuilderMultiDocument(t *testing.T) {
+	config := "name: app\nserver:\n  host: localhost\n---\nserver:\n  port: 8080\ndebug: true\n"
+
+	cfg := NewViperCfg().
+		WithConfigType("yaml").
+		WithMultiDocument().
+		ReadConfig(strings.NewReader(config)).
+		Build()
+	assert.Equal(t, "app", cfg.GetString("name"))
+	assert.Equal(t, "localhost", cfg.GetString("server.host"))
+	assert.Equal(t, 8080, cfg.GetInt("server.port"))
+	assert.True(t, cfg.GetBool("debug"))
+
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte(config), 0o600))
+	cfg = NewViperCfg().
+		WithConfigFiles(file).
+		WithMultiDocument().
+		ReadInConfig().
+		Build()
+	assert.Equal(t, "localhost", cfg.GetString("server.host"))
+	assert.Equal(t, 8080, cfg.GetInt("server.port"))
+
+	project, user := t.TempDir(), t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(user, "config.yaml"), []byte(config), 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(project, "config.yaml"), []byte("server:\n  host: project\n---\ndebug: false\n"), 0o600))
+	cfg = NewViperCfg().
+		WithConfigPaths(project, user).
+		WithMultiDocument().
+		ReadAllInConfig().
+		Build()
+	assert.Equal(t, "project", cfg.GetString("server.host"))
+	assert.Equal(t, 8080, cfg.GetInt("server.port"))
+	assert.False(t, cfg.GetBool("debug"))
+
+	override := filepath.Join(t.TempDir(), "override.yaml")
+	assert.NoError(t, os.WriteFile(override, []byte("name: override\n---\nserver:\n  port: 9090\n"), 0o600))
+	cfg = NewViperCfg().
+		WithMultiDocument().
+		WithMergeConfigFiles(file, override).
+		Build()
+	assert.Equal(t, "override", cfg.GetString("name"))
+	assert.Equal(t, "localhost", cfg.GetString("server.host"))
+	assert.Equal(t, 9090, cfg.GetInt("server.port"))
+	assert.True(t, cfg.GetBool("debug"))
+}
+
+func TestViperCfgBuilderPartialRead(t *testing.T) {
+	logs := new(bytes.Buffer)
+	log.SetOutput(logs)
+	defer log.SetOutput(os.Stderr)
+	config := `# app config
+server:
+  host: localhost
+database:
+  host: [unclosed
+logging:
+  level: info
+`
+	b := NewViperCfg().WithConfigType("yaml").WithPartialRead()
+	cfg := b.ReadConfig(strings.NewReader(config)).Build()
+
+	assert.Equal(t, "localhost", cfg.GetString("server.host"))
+	assert.Equal(t, "info", cfg.GetString("logging.level"))
+	assert.False(t, cfg.IsSet("database.host"))
+	assert.Len(t, b.SectionErrors(), 1)
+	assert.Equal(t, "database", b.SectionErrors()[0].Section)
+	assert.Contains(t, logs.String(), `Skipping invalid config section "database"`)
+
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte(config), 0o600))
+	b = NewViperCfg().WithConfigFiles(file).WithPartialRead()
+	cfg = b.ReadInConfig().Build()
+	assert.Equal(t, "info", cfg.GetString("logging.level"))
+	assert.Len(t, b.SectionErrors(), 1)
+
+	err := NewViperCfg().WithConfigType("yaml").readConfig(strings.NewReader(config))
+	assert.Error(t, err)
+}
+
+func TestViperCfgBuilderKeyInterpolation(t *testing.T) {
+	config := `host: example.com
+port: 8443
+base_url: https://{{host}}:{{ port }}
+health_url: "{{base_url}}/health"
+literal: \{{host}}
+`
+	cfg := NewViperCfg().
+		WithConfigType("yaml").
+		WithKeyInterpolation().
+		ReadConfig(strings.NewReader(config)).
+		Build()
+	assert.Equal(t, "https://example.com:8443", cfg.GetString("base_url"))
+	assert.Equal(t, "https://example.com:8443/health", cfg.GetString("health_url"))
+	assert.Equal(t, "{{host}}", cfg.GetString("literal"))
+
+	b := NewViperCfg().WithConfigType("yaml").WithKeyInterpolation()
+	err := b.readConfig(strings.NewReader("a: '{{b}}'\nb: '{{c}}'\nc: '{{a}}'\n"))
+	assert.ErrorContains(t, err, "config key interpolation cycle: a -> b -> c -> a")
+
+	err = b.readConfig(strings.NewReader("a: '{{missing}}'\n"))
+	assert.EqualError(t, err, `config key "a" references undefined key "missing"`)
+}
+
+func TestViperCfgBuilderValueTransform(t *testing.T) {
+	abs := func(v any) (any, error) {
+		return filepath.Abs(v.(string))
+	}
+	trim := func(v any) (any, error) {
+		return strings.TrimSpace(v.(string)), nil
+	}
+	cfg := NewViperCfg().
+		WithConfigType("yaml").
+		WithValueTransform("data_dir", trim).
+		WithValueTransform("data_dir", abs).
+		WithValueTransform("unset", abs).
+		ReadConfig(strings.NewReader("data_dir: ' data '")).
+		Build()
+
+	expected, _ := filepath.Abs("data")
+	assert.Equal(t, expected, cfg.GetString("data_dir"))
+	assert.False(t, cfg.IsSet("unset"))
+
+	b := NewViperCfg().
+		WithConfigType("yaml").
+		WithValueTransform("data_dir", func(any) (any, error) { return nil, io.ErrUnexpectedEOF })
+	err := b.readConfig(strings.NewReader("data_dir: data"))
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte("name: app"), 0o600))
+	t.Setenv("LEVEL", "Debug")
+	b = NewViperCfg().
+		WithConfigFiles(file).
+		WithAutomaticEnv().
+		WithValueTransform("name", func(v any) (any, error) { return v.(string) + "!", nil }).
+		WithValueTransform("level", func(v any) (any, error) { return strings.ToLower(v.(string)), nil }).
+		ReadInConfig()
+	assert.Equal(t, "app!", b.Build().GetString("name"))
+	assert.NoError(t, os.WriteFile(file, []byte("name: api"), 0o600))
+	_, err = b.Reload()
+	assert.NoError(t, err)
+	assert.Equal(t, "api!", b.Build().GetString("name"))
+	assert.Equal(t, "Debug", b.Build().GetString("level"))
+
+	b.MergeConfig(strings.NewReader("port: 8080"))
+	assert.Equal(t, "api!", b.Build().GetString("name"))
+
+	cmd := NewCobraCmd("app").WithNoOp().Build()
+	cfg = NewViperCfg().
+		WithConfigType("yaml").
+		WithProfileFlag(cmd, "env").
+		WithValueTransform("level", func(v any) (any, error) { return strings.ToLower(v.(string)), nil }).
+		ReadConfig(strings.NewReader("level: INFO\nprod:\n  level: WARN")).
+		Build()
+	cmd.SetArgs([]string{"--env", "prod"})
+	assert.NoError(t, cmd.Execute())
+	assert.Equal(t, "warn", cfg.GetString("level"))
+}
+
+func TestViperCfgBuilderReadAllInConfig(t *testing.T) {
+	project, user, empty := t.TempDir(), t.TempDir(), t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(project, "app.yaml"), []byte("log:\n  level: debug\n"), 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(user, "app.json"), []byte(`{"log": {"level": "info", "format": "json"}, "name": "user"}`), 0o600))
+
+	b := NewViperCfg().
+		WithConfigName("app").
+		WithConfigPaths(project, empty, user)
+	assert.Equal(t, []string{filepath.Join(project, "app.yaml"), filepath.Join(user, "app.json")}, b.FindConfigFiles())
+
+	cfg := b.ReadAllInConfig().Build()
+	assert.Equal(t, "debug", cfg.GetString("log.level"))
+	assert.Equal(t, "json", cfg.GetString("log.format"))
+	assert.Equal(t, "user", cfg.GetString("name"))
+	assert.Contains(t, b.LayerReport(), "log.level    -     debug   -         file")
+
+	_, err := NewViperCfg().WithConfigName("app").WithConfigPaths(empty).TryReadAllInConfig()
+	assert.EqualError(t, err, `config file "app" not found in [`+empty+`]`)
+	assert.ErrorAs(t, err, &viper.ConfigFileNotFoundError{})
+}
+
+func TestViperCfgBuilderConfigChecksum(t *testing.T) {
+	newBuilder := func(config string) *ViperCfgBuilder {
+		return NewViperCfg().
+			WithConfigType("yaml").
+			WithDefault("port", 8080).
+			ReadConfig(strings.NewReader(config))
+	}
+	b := newBuilder("name: app\nserver:\n  host: localhost\n  tls: true")
+	checksum := b.ConfigChecksum()
+	assert.Len(t, checksum, 32)
+	assert.Equal(t, checksum, b.ConfigChecksum())
+	assert.Equal(t, checksum, newBuilder("server:\n  tls: true\n  host: localhost\nname: app").ConfigChecksum())
+	assert.NotEqual(t, checksum, newBuilder("name: app\nserver:\n  host: remote\n  tls: true").ConfigChecksum())
+
+	b.Build().Set("port", "8080")
+	assert.NotEqual(t, checksum, b.ConfigChecksum())
+
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	b = NewViperCfg().WithDefault("at", at).WithDefault("labels", map[any]any{1: "one"})
+	expected := sha256.Sum256([]byte(`{"at":"2024-01-02T03:04:05Z","labels":{"1":"one"}}` + "\n"))
+	assert.Equal(t, expected[:], b.ConfigChecksum())
+}
+
+func TestViperCfgBuilderConfigPathOrder(t *testing.T) {
+	first, second, late := t.TempDir(), t.TempDir(), t.TempDir()
+	for _, dir := range []string{first, second, late} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "app.yaml"), []byte("dir: "+dir), 0o600))
+	}
+
+	cfg := NewViperCfg().
+		WithConfigName("app").
+		WithConfigPaths(first, second).
+		PrependConfigPath(late).
+		ReadInConfig().
+		Build()
+	assert.Equal(t, late, cfg.GetString("dir"))
+
+	b := NewViperCfg().
+		WithConfigName("app").
+		WithConfigPaths(first, second, late).
+		ReorderConfigPaths(late, "/not/added", second)
+	assert.Equal(t, []string{late, second, first}, b.configPaths)
+	assert.Equal(t, late, b.ReadInConfig().Build().GetString("dir"))
+}
+
+func TestViperCfgBuilderChangedFlags(t *testing.T) {
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	fs.String("name", "default", "")
+	fs.Int("port", 8080, "")
+	fs.StringSlice("tags", nil, "")
+	fs.Bool("debug", false, "")
+	assert.NoError(t, fs.Parse([]string{"--name", "cli", "--tags", "a,b", "--debug"}))
+
+	cfg := NewViperCfg().
+		WithConfigType("yaml").
+		WithChangedFlagsAs(fs, map[string]string{"debug": "log.debug"}).
+		ReadConfig(strings.NewReader("name: file\nport: 9090")).
+		Build()
+	assert.Equal(t, "cli", cfg.GetString("name"))
+	assert.Equal(t, 9090, cfg.GetInt("port"))
+	assert.Equal(t, []string{"a", "b"}, cfg.GetStringSlice("tags"))
+	assert.True(t, cfg.GetBool("log.debug"))
+	assert.False(t, cfg.IsSet("debug"))
+
+	cfg = NewViperCfg().WithChangedFlags(fs).Build()
+	assert.True(t, cfg.GetBool("debug"))
+	assert.False(t, cfg.IsSet("port"))
+}
+
+func TestViperCfgBuilderEnvOnly(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("name: file\nport: 9090"), 0o600))
+	cwd, _ := os.Getwd()
+	assert.NoError(t, os.Chdir(dir))
+	defer os.Chdir(cwd)
+	t.Setenv("APP_NAME", "env")
+	t.Setenv("APP_DATABASE_HOST", "db")
+
+	b := NewDefaultViperCfg("config").
+		WithDefault("database.host", "localhost").
+		EnvOnly("app").
+		WithConfigPaths(dir).
+		ReadInConfig()
+	cfg := b.Build()
+	assert.Equal(t, "env", cfg.GetString("name"))
+	assert.Equal(t, "db", cfg.GetString("database.host"))
+	assert.False(t, cfg.IsSet("port"))
+
+	v := viper.New()
+	v.Set("mode", "override")
+	v.SetDefault("timeout", "5s")
+	cfg = ToViperCfgBuilder(v).
+		WithConfigType("yaml").
+		ReadConfig(strings.NewReader("name: file")).
+		EnvOnly("app").
+		ReadInConfigAndBuild()
+	assert.Same(t, v, cfg)
+	assert.Equal(t, "env", cfg.GetString("name"))
+	assert.Equal(t, "override", cfg.GetString("mode"))
+	assert.Equal(t, "5s", cfg.GetString("timeout"))
+	assert.False(t, cfg.InConfig("name"))
+}
+
+func TestViperCfgBuilderEnvHelp(t *testing.T) {
+	cmd := NewCobraCmd("app").WithNoOp().Build()
+	NewViperCfg().
+		WithEnvPrefix("app").
+		WithEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_")).
+		WithAutomaticEnv().
+		WithDefault("database.host", "localhost").
+		WithDefault("log-level", "info").
+		WithEnvHelp(cmd)
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetArgs([]string{"--help"})
+	assert.NoError(t, cmd.Execute())
+
+	expected := `Usage:
+  app [flags]
+
+Flags:
+  -h, --help   help for app
+
+Environment Variables:
+  APP_DATABASE_HOST   database.host
+  APP_LOG_LEVEL       log-level
+`
+	assert.Equal(t, expected, out.String())
+}
+
+func TestViperCfgBuilderUnmarshalStrict(t *testing.T) {
+	type config struct {
+		Name    string
+		Timeout time.Duration
+	}
+	var c config
+	b := NewViperCfg().
+		WithConfigType("yaml").
+		ReadConfig(strings.NewReader("name: app\ntiemout: 5s"))
+	err := b.UnmarshalStrict(&c)
+	assert.ErrorContains(t, err, "tiemout")
+
+	b = NewViperCfg().
+		WithConfigType("yaml").
+		ReadConfig(strings.NewReader("name: app\ntimeout: 5s"))
+	assert.NoError(t, b.UnmarshalStrict(&c))
+	assert.Equal(t, config{Name: "app", Timeout: 5 * time.Second}, c)
+}
+
+func TestViperCfgBuilderReloadRestartRequiredKeys(t *testing.T) {
+	logs := new(bytes.Buffer)
+	log.SetOutput(logs)
+	defer log.SetOutput(os.Stderr)
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte("listen: :8080\nlog_level: info\nremoved: true"), 0o600))
+
+	b := NewViperCfg().
+		WithConfigFiles(file).
+		WithRestartRequiredKeys("listen").
+		ReadInConfig()
+
+	assert.NoError(t, os.WriteFile(file, []byte("listen: :8080\nlog_level: debug"), 0o600))
+	changed, err := b.Reload()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"log_level", "removed"}, changed)
+	assert.Empty(t, logs.String())
+
+	assert.NoError(t, os.WriteFile(file, []byte("listen: :9090\nlog_level: debug"), 0o600))
+	changed, err = b.Reload()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"listen"}, changed)
+	assert.Equal(t, ":9090", b.Build().GetString("listen"))
+	assert.Contains(t, logs.String(), `Config key "listen" changed, restart for the change to take effect`)
+}
+
+func TestViperCfgBuilderSnapshot(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte("db:\n  host: old\n  port: 1\nhosts: [a, b]"), 0o600))
+	b := NewViperCfg().WithConfigFiles(file).ReadInConfig()
+
+	snap := b.Snapshot()
+	assert.NoError(t, os.WriteFile(file, []byte("db:\n  host: new\n  port: 2\nhosts: [c]"), 0o600))
+	_, err := b.Reload()
+	assert.NoError(t, err)
+
+	assert.Equal(t, "old", snap.GetString("db.host"))
+	assert.Equal(t, 1, snap.GetInt("db.port"))
+	assert.Equal(t, []string{"a", "b"}, snap.GetStringSlice("hosts"))
+	assert.Equal(t, "new", b.Build().GetString("db.host"))
+	assert.Equal(t, "new", b.Snapshot().GetString("db.host"))
+}
+
+func TestViperCfgBuilderSnapshotWhileWatching(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte("secret: ENC[s]\nport: 1"), 0o600))
+	b := NewViperCfg().
+		WithConfigFiles(file).
+		WithValueDecryptor("ENC[", func(string) (string, error) { return "plain", nil }).
+		WithWatch(func(fsnotify.Event) {}).
+		ReadInConfig()
+	b.Build()
+
+	var sawEncrypted atomic.Bool
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if strings.HasPrefix(b.Snapshot().GetString("secret"), "ENC[") {
+				sawEncrypted.Store(true)
+			}
+		}
+	}()
+	for port := 2; port <= 4; port++ {
+		assert.NoError(t, os.WriteFile(file, []byte(fmt.Sprintf("secret: ENC[s]\nport: %d", port)), 0o600))
+		deadline := time.Now().Add(5 * time.Second)
+		for b.Snapshot().GetInt("port") != port && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.Equal(t, port, b.Snapshot().GetInt("port"))
+	}
+	close(done)
+	wg.Wait()
+	assert.False(t, sawEncrypted.Load())
+}
+
+func TestViperCfgBuilderConfigResetCmd(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte("db:\n  host: custom\nextra: true"), 0o600))
+	config := NewCobraCmd("config").Build()
+	NewViperCfg().
+		WithConfigFiles(file).
+		WithDefault("db.host", "localhost").
+		WithDefault("db.port", 5432).
+		WithConfigResetCmd(config).
+		ReadInConfig()
+
+	config.SetArgs([]string{"reset", "--yes"})
+	config.SetOut(io.Discard)
+	assert.NoError(t, config.Execute())
+
+	reset := viper.New()
+	reset.SetConfigFile(file)
+	assert.NoError(t, reset.ReadInConfig())
+	assert.Equal(t, map[string]any{"db": map[string]any{"host": "localhost", "port": 5432}}, reset.AllSettings())
+}
+
+func TestViperCfgBuilderWithConfigFromDir(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "log.level"), []byte("debug\n"), 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "name"), []byte("app"), 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, ".hidden"), []byte("x"), 0o600))
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "..data"), 0o700))
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte("name: file\nport: 80"), 0o600))
+
+	cfg := NewViperCfg().
+		WithConfigFiles(file).
+		WithConfigFromDir(dir).
+		WithConfigFromDir(filepath.Join(dir, "missing")).
+		ReadInConfigAndBuild()
+
+	assert.Equal(t, "debug", cfg.GetString("log.level"))
+	assert.Equal(t, "app", cfg.GetString("name"))
+	assert.Equal(t, 80, cfg.GetInt("port"))
+	assert.ElementsMatch(t, []string{"log.level", "name", "port"}, cfg.AllKeys())
+}
+
+func TestViperCfgBuilderWithReloadFunc(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte("a: 1\nb: 1\nc: 1"), 0o600))
+	var calls [][]string
+	b := NewViperCfg().
+		WithConfigFiles(file).
+		WithReloadFunc(func(changed []string) { calls = append(calls, changed) }).
+		ReadInConfig()
+
+	assert.NoError(t, os.WriteFile(file, []byte("a: 2\nb: 2\nc: 1\nd: 1"), 0o600))
+	_, err := b.Reload()
+	assert.NoError(t, err)
+	_, err = b.Reload()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"a", "b", "d"}}, calls)
+}
+
+func TestViperCfgBuilderTryReadInConfig(t *testing.T) {
+	dir := t.TempDir()
+	_, err := NewViperCfg().WithConfigPaths(dir).WithConfigName("missing").TryReadInConfig()
+	var notFound viper.ConfigFileNotFoundError
+	assert.ErrorAs(t, err, &notFound)
+
+	file := filepath.Join(dir, "config.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte("a: [1"), 0o600))
+	_, err = NewViperCfg().WithConfigFiles(file).TryReadInConfig()
+	var parseErr viper.ConfigParseError
+	assert.ErrorAs(t, err, &parseErr)
+
+	assert.NoError(t, os.WriteFile(file, []byte("a: 1"), 0o600))
+	b, err := NewViperCfg().WithConfigFiles(file).TryReadInConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, b.Build().GetInt("a"))
+}
+
+func TestViperCfgBuilderTryReadConfig(t *testing.T) {
+	_, err := NewViperCfg().WithConfigType("yaml").TryReadConfig(strings.NewReader("a: [1"))
+	var parseErr viper.ConfigParseError
+	assert.ErrorAs(t, err, &parseErr)
+
+	b, err := NewViperCfg().WithConfigType("yaml").TryReadConfig(strings.NewReader("a: 1"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, b.Build().GetInt("a"))
+}
+
+func TestViperCfgBuilderWriteConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	b := NewViperCfg().WithDefaults(map[string]any{"name": "app", "db.port": 5432})
+
+	_, err := b.SafeWriteConfigAs(path)
+	assert.NoError(t, err)
+	cfg := NewViperCfg().WithConfigFiles(path).ReadInConfig().Build()
+	assert.Equal(t, "app", cfg.GetString("name"))
+	assert.Equal(t, 5432, cfg.GetInt("db.port"))
+
+	_, err = b.SafeWriteConfigAs(path)
+	var exists viper.ConfigFileAlreadyExistsError
+	assert.ErrorAs(t, err, &exists)
+	assert.ErrorContains(t, err, "refusing to overwrite existing config file "+path)
+
+	rb := NewViperCfg().WithConfigFiles(path).ReadInConfig()
+	rb.Build().Set("name", "changed")
+	_, err = rb.WriteConfig()
+	assert.NoError(t, err)
+	cfg = NewViperCfg().WithConfigFiles(path).ReadInConfig().Build()
+	assert.Equal(t, "changed", cfg.GetString("name"))
+	assert.Equal(t, 5432, cfg.GetInt("db.port"))
+
+	_, err = NewViperCfg().WriteConfig()
+	assert.ErrorIs(t, err, ErrNoConfigFile)
+}
+
+func TestNewDefaultViperCfgE(t *testing.T) {
+	dir := t.TempDir()
+	cwd, _ := os.Getwd()
+	assert.NoError(t, os.Chdir(dir))
+	defer os.Chdir(cwd)
+
+	b, err := NewDefaultViperCfgE("boa-test")
+	assert.NoError(t, err)
+	assert.NotNil(t, b)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "boa-test.yaml"), []byte("a: [1"), 0o600))
+	b, err = NewDefaultViperCfgE("boa-test")
+	var parseErr viper.ConfigParseError
+	assert.ErrorAs(t, err, &parseErr)
+	assert.NotNil(t, b)
+
+	logs := new(bytes.Buffer)
+	log.SetOutput(logs)
+	defer log.SetOutput(os.Stderr)
+	assert.NotNil(t, NewDefaultViperCfg("boa-test"))
+	assert.Contains(t, logs.String(), "Warning: error reading config: ")
+}
+
+func TestViperCfgBuilderWithProfileFlag(t *testing.T) {
+	newCmd := func() (*cobra.Command, *viper.Viper) {
+		cmd := NewCobraCmd("app").WithNoOp().Build()
+		cmd.SilenceErrors, cmd.SilenceUsage = true, true
+		cfg := NewViperCfg().
+			WithConfigType("yaml").
+			WithOverrideFlag(cmd).
+			WithProfileFlag(cmd, "env").
+			ReadConfig(strings.NewReader("db:\n  host: localhost\n  port: 5432\nprod:\n  db:\n    host: prod-db")).
+			Build()
+		return cmd, cfg
+	}
+
+	cmd, cfg := newCmd()
+	cmd.SetArgs([]string{"--env", "prod", "--set", "db.port=6432"})
+	assert.NoError(t, cmd.Execute())
+	assert.Equal(t, "prod-db", cfg.GetString("db.host"))
+	assert.Equal(t, 6432, cfg.GetInt("db.port"))
+
+	cmd, cfg = newCmd()
+	cmd.SetArgs([]string{})
+	assert.NoError(t, cmd.Execute())
+	assert.Equal(t, "localhost", cfg.GetString("db.host"))
+
+	cmd, _ = newCmd()
+	cmd.SetArgs([]string{"--env", "staging"})
+	assert.EqualError(t, cmd.Execute(), `unknown config profile "staging"`)
+
+	cmd = NewCobraCmd("app").WithNoOp().Build()
+	t.Setenv("APP_DB_USER", "env-user")
+	cfg = NewViperCfg().
+		WithEnvPrefix("app").
+		WithEnvKeyReplacer(strings.NewReplacer(".", "_")).
+		WithAutomaticEnv().
+		WithConfigType("yaml").
+		WithProfileFlag(cmd, "env").
+		WithOverrideFlag(cmd).
+		ReadConfig(strings.NewReader("db:\n  host: localhost\n  user: app\nprod:\n  db:\n    host: prod-db\n    port: 6432\n    user: prod")).
+		Build()
+	cmd.SetArgs([]string{"--set", "db.host=set-db", "--env", "prod"})
+	assert.NoError(t, cmd.Execute())
+	assert.Equal(t, "set-db", cfg.GetString("db.host"))
+	assert.Equal(t, 6432, cfg.GetInt("db.port"))
+	assert.Equal(t, "env-user", cfg.GetString("db.user"))
+}
+
+func TestViperCfgBuilderWithProfileFlagProcessesProfile(t *testing.T) {
+	cmd := NewCobraCmd("app").WithNoOp().Build()
+	b := NewViperCfg().
+		WithConfigType("yaml").
+		WithProfileFlag(cmd, "env").
+		WithValueDecryptor("ENC[", func(s string) (string, error) {
+			return "plain-" + strings.TrimSuffix(strings.TrimPrefix(s, "ENC["), "]"), nil
+		}).
+		WithValueTransform("db.host", func(v any) (any, error) { return strings.ToLower(v.(string)), nil }).
+		ReadConfig(strings.NewReader("db:\n  host: localhost\nprod:\n  db:\n    host: PROD\n    password: ENC[prod]"))
+	cfg := b.Build()
+	cmd.SetArgs([]string{"--env", "prod"})
+	assert.NoError(t, cmd.Execute())
+	assert.Equal(t, "prod", cfg.GetString("db.host"))
+	assert.Equal(t, "plain-prod", cfg.GetString("db.password"))
+
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	_, err := b.WriteConfigAs(file)
+	assert.NoError(t, err)
+	written, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(written), "plain-")
+	assert.Contains(t, string(written), "password: ENC[prod]")
+
+	dump := new(bytes.Buffer)
+	assert.NoError(t, b.DumpConfig(dump))
+	assert.NotContains(t, dump.String(), "plain-")
+	assert.Contains(t, dump.String(), "db:\n  host: prod # from file\n  password: '[redacted]' # from file\n")
+	assert.NotContains(t, b.LayerReport(), "plain-")
+}
+
+func TestViperCfgBuilderWithDefaultsPrecedence(t *testing.T) {
+	t.Setenv("APP_ENV", "env")
+	t.Setenv("APP_SET", "env")
+	b := NewViperCfg().
+		WithDefaults(map[string]any{
+			"default": "default",
+			"file":    "default",
+			"env":     "default",
+			"set":     "default",
+		}).
+		WithEnvPrefix("app").
+		WithAutomaticEnv().
+		WithConfigType("yaml").
+		ReadConfig(strings.NewReader("file: file\nenv: file\nset: file"))
+	cfg := b.Build()
+	cfg.Set("set", "set")
+
+	assert.Equal(t, "default", cfg.GetString("default"))
+	assert.Equal(t, "file", cfg.GetString("file"))
+	assert.Equal(t, "env", cfg.GetString("env"))
+	assert.Equal(t, "set", cfg.GetString("set"))
+}
+
+func TestViperCfgBuilderWithBoundPFlags(t *testing.T) {
+	cmd := NewCobraCmd("app").
+		WithStringFlag("host", "flag-default", "host").
+		WithIntFlag("port", 80, "port").
+		WithStringFlag("name", "flag-default", "name").
+		Build()
+	b := NewViperCfg().
+		WithBoundPFlags(cmd.Flags()).
+		WithConfigType("yaml").
+		ReadConfig(strings.NewReader("host: file\nport: 8080"))
+	assert.NoError(t, cmd.ParseFlags([]string{"--host", "flag"}))
+	cfg := b.Build()
+
+	assert.Equal(t, "flag", cfg.GetString("host"))
+	assert.Equal(t, 8080, cfg.GetInt("port"))
+	assert.Equal(t, "flag-default", cfg.GetString("name"))
+	assert.Contains(t, b.LayerReport(), "host   flag   -     file   -         flag\n")
+}
+
+func TestViperCfgBuilderReadInConfigAndUnmarshal(t *testing.T) {
+	type database struct {
+		Host     string `mapstructure:"host"`
+		Password string `mapstructure:"password"`
+	}
+	type config struct {
+		Name     string        `mapstructure:"name"`
+		Timeout  time.Duration `mapstructure:"timeout"`
+		Database database      `mapstructure:"db"`
+	}
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte("name: app\ntimeout: 5s\ndb:\n  host: localhost"), 0o600))
+	t.Setenv("APP_DB_PASSWORD", "secret")
+
+	var c config
+	err := NewViperCfg().
+		WithConfigFiles(file).
+		WithEnvPrefix("app").
+		WithDefaultEnvKeyReplacer().
+		WithAutomaticEnv().
+		ReadInConfigAndUnmarshal(&c)
+	assert.NoError(t, err)
+	assert.Equal(t, config{
+		Name:     "app",
+		Timeout:  5 * time.Second,
+		Database: database{Host: "localhost", Password: "secret"},
+	}, c)
+
+	var bad struct {
+		Timeout int `mapstructure:"timeout"`
+	}
+	_, err = NewViperCfg().WithConfigFiles(file).ReadInConfig().UnmarshalInto(&bad)
+	assert.ErrorContains(t, err, "unmarshalling config: ")
+}
+
+func TestViperCfgBuilderDumpConfig(t *testing.T) {
+	t.Setenv("APP_DB_HOST", "env-db")
+	cmd := NewCobraCmd("app").WithIntFlag("db.port", 0, "db port").Build()
+	b := NewViperCfg().
+		WithDefault("log.level", "info").
+		WithDefault("db.host", "localhost").
+		WithBoundPFlag("db.port", cmd.Flags().Lookup("db.port")).
+		WithEnvPrefix("app").
+		WithDefaultEnvKeyReplacer().
+		WithAutomaticEnv().
+		WithConfigType("yaml").
+		ReadConfig(strings.NewReader("name: app\ntags: [a, b]\ndb:\n  port: 5432"))
+	assert.NoError(t, cmd.ParseFlags([]string{"--db.port", "6432"}))
+
+	out := new(bytes.Buffer)
+	assert.NoError(t, b.DumpConfig(out))
+	assert.Equal(t, `db:
+  host: env-db # from env
+  port: 6432 # from flag
+log:
+  level: info # from default
+name: app # from file
+tags: # from file
+  - a
+  - b
+`, out.String())
+}
+
+func TestViperCfgBuilderWithWatch(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte("level: info"), 0o600))
+	changed := make(chan string, 10)
+	reloaded := make(chan []string, 10)
+	var cfg *viper.Viper
+	cfg = NewViperCfg().
+		WithConfigFiles(file).
+		WithValueTransform("level", func(v any) (any, error) { return strings.ToUpper(v.(string)), nil }).
+		WithReloadFunc(func(keys []string) { reloaded <- keys }).
+		WithWatch(func(fsnotify.Event) { changed <- cfg.GetString("level") }).
+		ReadInConfigAndBuild()
+
+	assert.NoError(t, os.WriteFile(file, []byte("level: debug"), 0o600))
+	select {
+	case level := <-changed:
+		assert.Equal(t, "DEBUG", level)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for config change")
+	}
+	assert.Equal(t, []string{"level"}, <-reloaded)
+}
+
+func TestViperCfgBuilderWithConfigTemplating(t *testing.T) {
+	logs := new(bytes.Buffer)
+	log.SetOutput(logs)
+	defer log.SetOutput(os.Stderr)
+	data := struct{ Home string }{Home: "/home/user"}
+
+	cfg := NewViperCfg().
+		WithConfigTemplating(data).
+		WithKeyInterpolation().
+		WithConfigType("yaml").
+		ReadConfig(strings.NewReader("app: myapp\ncache_dir: '{{.Home}}/.cache/{{app}}'\nbad: '{{.Missing}}'\nplain: text")).
+		Build()
+
+	assert.Equal(t, "/home/user/.cache/myapp", cfg.GetString("cache_dir"))
+	assert.Equal(t, "{{.Missing}}", cfg.GetString("bad"))
+	assert.Equal(t, "text", cfg.GetString("plain"))
+	assert.Contains(t, logs.String(), `Not rendering config key "bad"`)
+}
+
+func TestViperCfgBuilderWithMergeConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	defaults := filepath.Join(dir, "defaults.yaml")
+	override := filepath.Join(dir, "override.yaml")
+	assert.NoError(t, os.WriteFile(defaults, []byte("name: app\ndb:\n  host: localhost\n  port: 5432"), 0o600))
+	assert.NoError(t, os.WriteFile(override, []byte("db:\n  port: 6432"), 0o600))
+
+	cfg := NewViperCfg().
+		WithMergeConfigFiles(defaults, filepath.Join(dir, "missing.yaml"), override).
+		Build()
+	assert.Equal(t, "app", cfg.GetString("name"))
+	assert.Equal(t, "localhost", cfg.GetString("db.host"))
+	assert.Equal(t, 6432, cfg.GetInt("db.port"))
+
+	user := filepath.Join(dir, "user.yaml")
+	b := NewViperCfg().
+		WithRequiredKeys("name").
+		WithMergeConfigFiles(user).
+		WithMergeConfigFiles(defaults, override)
+	assert.NoError(t, os.WriteFile(user, []byte("name: user"), 0o600))
+	assert.NoError(t, os.WriteFile(override, []byte("db:\n  port: 7432"), 0o600))
+	changed, err := b.Reload()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"db.port"}, changed)
+	assert.Equal(t, "app", b.Build().GetString("name"))
+	assert.Equal(t, 7432, b.Build().GetInt("db.port"))
+
+	_, err = NewViperCfg().WithRequiredKeys("name").WithMergeConfigFiles(filepath.Join(dir, "missing.yaml")).Reload()
+	assert.NoError(t, err)
+
+	cfg = NewViperCfg().
+		WithConfigType("yaml").
+		MergeConfig(strings.NewReader("name: app\ndb:\n  host: localhost\n  port: 5432")).
+		MergeConfig(strings.NewReader("db:\n  host: db")).
+		Build()
+	assert.Equal(t, "db", cfg.GetString("db.host"))
+	assert.Equal(t, 5432, cfg.GetInt("db.port"))
+}
+
+func TestViperCfgBuilderMergeConfigProcessesOnce(t *testing.T) {
+	prefix := func(v any) (any, error) { return "x-" + v.(string), nil }
+	b := NewViperCfg().
+		WithConfigType("yaml").
+		WithKeyInterpolation().
+		WithValueTransform("name", prefix).
+		ReadConfig(strings.NewReader("name: app\nlabel: '\\{{name}}'")).
+		MergeConfig(strings.NewReader("port: 8080"))
+	cfg := b.Build()
+	assert.Equal(t, "x-app", cfg.GetString("name"))
+	assert.Equal(t, "{{name}}", cfg.GetString("label"))
+	assert.Equal(t, 8080, cfg.GetInt("port"))
+
+	_, err := b.TryMergeConfig(strings.NewReader("port: ["))
+	assert.ErrorAs(t, err, &viper.ConfigParseError{})
+	assert.Equal(t, "x-app", cfg.GetString("name"))
+	assert.Equal(t, 8080, cfg.GetInt("port"))
+
+	file := filepath.Join(t.TempDir(), "override.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte("port: 9090"), 0o600))
+	b.WithMergeConfigFiles(file)
+	assert.Equal(t, "x-app", cfg.GetString("name"))
+	assert.Equal(t, "{{name}}", cfg.GetString("label"))
+	assert.Equal(t, 9090, cfg.GetInt("port"))
+}
+
+func TestViperCfgBuilderStats(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte("name: app\ndb:\n  host: localhost\n  port: 5432"), 0o600))
+	var emitted []ConfigStats
+	before := time.Now()
+	b := NewViperCfg().
+		WithConfigFiles(file).
+		WithStatsFunc(func(s ConfigStats) { emitted = append(emitted, s) }).
+		ReadInConfig()
+
+	stats := b.Stats()
+	assert.Equal(t, []string{file}, stats.Files)
+	assert.Equal(t, 3, stats.Keys)
+	assert.Greater(t, stats.Duration, time.Duration(0))
+	assert.False(t, stats.LoadedAt.Before(before))
+	assert.Equal(t, 1, stats.Loads)
+
+	_, err := b.Reload()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, b.Stats().Loads)
+	assert.Len(t, emitted, 2)
+}
+
+func TestViperCfgBuilderWithFlagDefaultsFromConfig(t *testing.T) {
+	t.Setenv("APP_LOG_LEVEL", "debug")
+	cmd := NewCobraCmd("app").
+		WithIntFlag("port", 80, "port to listen on").
+		WithStringFlag("level", "info", "log level").
+		WithStringFlag("name", "app", "name").
+		WithNoOp().
+		Build()
+	NewViperCfg().
+		WithBoundPFlag("log.level", cmd.Flags().Lookup("level")).
+		WithEnvPrefix("app").
+		WithDefaultEnvKeyReplacer().
+		WithAutomaticEnv().
+		WithConfigType("yaml").
+		ReadConfig(strings.NewReader("port: 8080")).
+		WithFlagDefaultsFromConfig(cmd)
+
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetArgs([]string{"--help"})
+	assert.NoError(t, cmd.Execute())
+	assert.Contains(t, out.String(), `--port int       port to listen on (default 8080)`)
+	assert.Contains(t, out.String(), `--level string   log level (default "debug")`)
+	assert.Contains(t, out.String(), `--name string    name (default "app")`)
+}
+
+func TestViperCfgBuilderWithConfigPartialUnmarshalErrors(t *testing.T) {
+	type database struct {
+		Conns int `mapstructure:"conns"`
+	}
+	type config struct {
+		Name     string        `mapstructure:"name"`
+		Port     int           `mapstructure:"port"`
+		Timeout  time.Duration `mapstructure:"timeout"`
+		Database database      `mapstructure:"db"`
+	}
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte("name: app\nport: abc\ntimeout: 5s\ndb:\n  conns: many"), 0o600))
+
+	var c config
+	_, err := NewViperCfg().
+		WithConfigFiles(file).
+		WithConfigPartialUnmarshalErrors().
+		ReadInConfig().
+		UnmarshalInto(&c)
+	assert.ErrorContains(t, err, `config key "port": expected int, got "abc"`)
+	assert.ErrorContains(t, err, `config key "db.conns": expected int, got "many"`)
+	assert.NotContains(t, err.Error(), "timeout")
+	assert.NotContains(t, err.Error(), "name")
+}
+
+func TestViperCfgBuilderWithValueDecryptor(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte("user: admin\ndb:\n  password: ENC[terces]"), 0o600))
+	decrypt := func(v string) (string, error) {
+		r := []rune(strings.TrimSuffix(strings.TrimPrefix(v, "ENC["), "]"))
+		for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+			r[i], r[j] = r[j], r[i]
+		}
+		return string(r), nil
+	}
+
+	b := NewViperCfg().WithConfigFiles(file).WithValueDecryptor("ENC[", decrypt).ReadInConfig()
+	cfg := b.Build()
+	assert.Equal(t, "secret", cfg.GetString("db.password"))
+	assert.Equal(t, "admin", cfg.GetString("user"))
+
+	cfg.Set("user", "root")
+	_, err := b.WriteConfig()
+	assert.NoError(t, err)
+	data, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "password: ENC[terces]")
+	assert.NotContains(t, string(data), "secret")
+	assert.Contains(t, string(data), "user: root")
+	assert.Equal(t, "secret", cfg.GetString("db.password"))
+
+	dump := new(bytes.Buffer)
+	assert.NoError(t, b.DumpConfig(dump))
+	assert.Equal(t, "db:\n  password: '[redacted]' # from file\nuser: root # from file\n", dump.String())
+	assert.NotContains(t, b.LayerReport(), "secret")
+
+	_, err = NewViperCfg().
+		WithConfigFiles(file).
+		WithValueDecryptor("ENC[", func(string) (string, error) { return "", errors.New("no key") }).
+		TryReadInConfig()
+	assert.EqualError(t, err, `decrypting config key "db.password": no key`)
+}
@@ -0,0 +1,53 @@
+package boa
+
+import (
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// WithStringFlagFromViper defines a string flag whose default is the value
+// of key in v, or fallback if v doesn't set key. The value is read when this
+// is called, so the config should be read before the command is built.
+func (b *CobraCmdBuilder) WithStringFlagFromViper(v *viper.Viper, key string, name string, fallback string, usage string) *CobraCmdBuilder {
+	if v.IsSet(key) {
+		fallback = v.GetString(key)
+	}
+	return b.WithStringFlag(name, fallback, usage)
+}
+
+// WithBoolFlagFromViper is like WithStringFlagFromViper, but defines a bool
+// flag.
+func (b *CobraCmdBuilder) WithBoolFlagFromViper(v *viper.Viper, key string, name string, fallback bool, usage string) *CobraCmdBuilder {
+	if v.IsSet(key) {
+		fallback = v.GetBool(key)
+	}
+	return b.WithBoolFlag(name, fallback, usage)
+}
+
+// WithIntFlagFromViper is like WithStringFlagFromViper, but defines an int
+// flag.
+func (b *CobraCmdBuilder) WithIntFlagFromViper(v *viper.Viper, key string, name string, fallback int, usage string) *CobraCmdBuilder {
+	if v.IsSet(key) {
+		fallback = v.GetInt(key)
+	}
+	return b.WithIntFlag(name, fallback, usage)
+}
+
+// WithDurationFlagFromViper is like WithStringFlagFromViper, but defines a
+// time.Duration flag.
+func (b *CobraCmdBuilder) WithDurationFlagFromViper(v *viper.Viper, key string, name string, fallback time.Duration, usage string) *CobraCmdBuilder {
+	if v.IsSet(key) {
+		fallback = v.GetDuration(key)
+	}
+	return b.WithDurationFlag(name, fallback, usage)
+}
+
+// WithStringSliceFlagFromViper is like WithStringFlagFromViper, but defines
+// a []string flag.
+func (b *CobraCmdBuilder) WithStringSliceFlagFromViper(v *viper.Viper, key string, name string, fallback []string, usage string) *CobraCmdBuilder {
+	if v.IsSet(key) {
+		fallback = v.GetStringSlice(key)
+	}
+	return b.WithStringSliceFlag(name, fallback, usage)
+}
@@ -0,0 +1,163 @@
+package boa
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/viper"
+)
+
+// redacted is shown in place of the values of secrets when reporting the
+// config.
+const redacted = "[redacted]"
+
+// configLayer is a single source of configuration values, such as env vars
+// or the config file.
+type configLayer struct {
+	name string
+	get  func(key string) (any, bool)
+}
+
+// LayerReport returns a table showing, for every known key, the value set by
+// each configuration layer and which layer wins. Layers are listed from the
+// highest precedence to the lowest.
+//
+// The values of secrets, such as those read from Vault or decrypted by
+// WithValueDecryptor, are redacted.
+//
+// Only values set through the builder can be attributed to a layer; a value
+// set directly on the underlying viper.Viper is reported as coming from an
+// "other" layer.
+func (b *ViperCfgBuilder) LayerReport() string {
+	layers := b.layers()
+	buf := new(bytes.Buffer)
+	w := tabwriter.NewWriter(buf, 3, 3, 3, ' ', 0)
+	fmt.Fprint(w, "KEY")
+	for _, l := range layers {
+		fmt.Fprintf(w, "\t%s", strings.ToUpper(l.name))
+	}
+	fmt.Fprintln(w, "\tWINNER")
+	keys := b.cfg.AllKeys()
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprint(w, k)
+		for _, l := range layers {
+			v, ok := l.get(k)
+			if !ok {
+				fmt.Fprint(w, "\t-")
+				continue
+			}
+			if b.isSecret(k) {
+				v = redacted
+			}
+			fmt.Fprintf(w, "\t%v", v)
+		}
+		fmt.Fprintf(w, "\t%s\n", source(layers, k))
+	}
+	w.Flush()
+	return buf.String()
+}
+
+// source returns the name of the first of layers that sets key, or "other"
+// if none of them do.
+func source(layers []configLayer, key string) string {
+	for _, l := range layers {
+		if _, ok := l.get(key); ok {
+			return l.name
+		}
+	}
+	return "other"
+}
+
+// layers returns the configuration layers known to the builder in order of
+// precedence. The override layer is only included once WithOverrideFlag has
+// been used, the flag layer once a flag has been bound and the vault layer
+// once a secret has been read from Vault.
+func (b *ViperCfgBuilder) layers() []configLayer {
+	layers := b.runtimeLayers()
+	if len(b.secrets) > 0 {
+		layers = append(layers, configLayer{"vault", b.secretValue})
+	}
+	file := b.fileLayer()
+	return append(layers,
+		configLayer{"file", func(key string) (any, bool) {
+			return file.Get(key), file.IsSet(key)
+		}},
+		configLayer{"default", b.defaultValue},
+	)
+}
+
+// runtimeLayers returns the layers that take precedence over the config read
+// from files: overrides, bound flags and env vars.
+func (b *ViperCfgBuilder) runtimeLayers() []configLayer {
+	var layers []configLayer
+	if b.overrides != nil {
+		layers = append(layers, configLayer{"override", func(key string) (any, bool) {
+			v, ok := b.overrides[key]
+			return v, ok
+		}})
+	}
+	if b.boundFlags != nil {
+		layers = append(layers, configLayer{"flag", func(key string) (any, bool) {
+			f, ok := b.boundFlags[key]
+			if !ok || !f.Changed {
+				return nil, false
+			}
+			return f.Value.String(), true
+		}})
+	}
+	return append(layers, configLayer{"env", b.envValue})
+}
+
+// setAtRuntime returns whether key is set by one of the runtime layers.
+func (b *ViperCfgBuilder) setAtRuntime(key string) bool {
+	for _, l := range b.runtimeLayers() {
+		if _, ok := l.get(key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// envName returns the env var that viper associates with key, taking the env
+// prefix into account.
+func (b *ViperCfgBuilder) envName(key string) string {
+	if b.envPrefix != "" {
+		return strings.ToUpper(b.envPrefix + "_" + key)
+	}
+	return strings.ToUpper(key)
+}
+
+// envValue looks up key in the environment the same way viper does.
+func (b *ViperCfgBuilder) envValue(key string) (any, bool) {
+	names := b.boundEnvs[key]
+	if b.automaticEnv {
+		names = append([]string{b.envName(key)}, names...)
+	}
+	for _, name := range names {
+		if b.envReplacer != nil {
+			name = b.envReplacer.Replace(name)
+		}
+		if v, ok := os.LookupEnv(name); ok && v != "" {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// fileLayer returns a viper instance holding only the values read from the
+// config file.
+func (b *ViperCfgBuilder) fileLayer() *viper.Viper {
+	file := viper.New()
+	if b.configType != "" {
+		file.SetConfigType(b.configType)
+	}
+	b.loadSources(file)
+	b.mergeConfigDirs(file)
+	b.mergeProfile(file)
+	return file
+}
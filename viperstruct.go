@@ -0,0 +1,337 @@
+package boa
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+)
+
+// DefaultsPrecedence controls which defaults win when a key is given a
+// default by both WithDefault and WithDefaultsFromStruct.
+type DefaultsPrecedence int
+
+const (
+	// ExplicitDefaultsWin gives defaults set with WithDefault precedence over
+	// those derived from a struct.
+	ExplicitDefaultsWin DefaultsPrecedence = iota
+	// StructDefaultsWin gives defaults derived from a struct precedence over
+	// those set with WithDefault.
+	StructDefaultsWin
+)
+
+// WithRequiredKeysFromStruct marks the keys of any fields of the struct v
+// tagged with `validate:"required"` or `required:"true"` as required keys, so
+// that the struct the config is unmarshalled into remains the single place
+// they are declared. Keys are named the way viper unmarshals them, honouring
+// mapstructure tags, and nested structs produce dot delimited keys.
+func (b *ViperCfgBuilder) WithRequiredKeysFromStruct(v any) *ViperCfgBuilder {
+	return b.WithRequiredKeys(requiredStructKeys(reflect.TypeOf(v), "", map[reflect.Type]bool{})...)
+}
+
+// WithDefaultsFromStruct sets a default for every field of the struct v,
+// using the field's value. Keys are named the way viper unmarshals them,
+// honouring mapstructure tags, and nested structs produce dot delimited keys.
+//
+// When a key is also given a default with WithDefault, the winner is decided
+// by WithDefaultsPrecedence rather than the order of the calls.
+func (b *ViperCfgBuilder) WithDefaultsFromStruct(v any) *ViperCfgBuilder {
+	if b.structDefaults == nil {
+		b.structDefaults = map[string]any{}
+	}
+	structDefaults(reflect.ValueOf(v), "", b.structDefaults, map[reflect.Type]bool{})
+	b.applyDefaults()
+	return b
+}
+
+// WithDefaultsPrecedence sets whether defaults set with WithDefault or those
+// derived from a struct with WithDefaultsFromStruct win when both set the
+// same key. ExplicitDefaultsWin is used if this isn't called.
+func (b *ViperCfgBuilder) WithDefaultsPrecedence(p DefaultsPrecedence) *ViperCfgBuilder {
+	b.defaultsPrecedence = p
+	b.applyDefaults()
+	return b
+}
+
+// UnmarshalStrict unmarshals the configuration into target, failing with an
+// error naming any keys that are set but don't map to a field of target.
+// This catches typos in config files, such as `tiemout` for `timeout`, that
+// would otherwise be silently ignored.
+func (b *ViperCfgBuilder) UnmarshalStrict(target any) error {
+	return b.cfg.UnmarshalExact(target)
+}
+
+// WithConfigPartialUnmarshalErrors makes UnmarshalInto decode each field of
+// the target on its own when unmarshalling fails, so that every key holding a
+// value of the wrong type is reported at once, along with the type expected,
+// rather than leaving them to be fixed one at a time.
+func (b *ViperCfgBuilder) WithConfigPartialUnmarshalErrors() *ViperCfgBuilder {
+	b.partialUnmarshal = true
+	return b
+}
+
+// UnmarshalInto unmarshals the configuration into out, honouring mapstructure
+// tags. When automatic env is enabled, the keys of out's fields are bound to
+// env vars first, so that fields set only by an env var are filled too.
+func (b *ViperCfgBuilder) UnmarshalInto(out any, opts ...viper.DecoderConfigOption) (*ViperCfgBuilder, error) {
+	if b.automaticEnv {
+		for _, k := range structKeys(reflect.TypeOf(out), "", map[reflect.Type]bool{}) {
+			b.cfg.BindEnv(k)
+		}
+	}
+	if err := b.cfg.Unmarshal(out, opts...); err != nil {
+		if b.partialUnmarshal {
+			if errs := b.fieldUnmarshalErrors(reflect.TypeOf(out), "", map[reflect.Type]bool{}); len(errs) > 0 {
+				err = errors.Join(errs...)
+			}
+		}
+		return b, fmt.Errorf("unmarshalling config: %w", err)
+	}
+	return b, nil
+}
+
+// fieldUnmarshalErrors decodes the value of each key of the fields of t,
+// prefixed by prefix, into the field's type, returning an error for every
+// value that can't be decoded. Struct types in seen, those t is nested in,
+// are skipped.
+func (b *ViperCfgBuilder) fieldUnmarshalErrors(t reflect.Type, prefix string, seen map[reflect.Type]bool) []error {
+	t, ok := enterStruct(t, seen)
+	if !ok {
+		return nil
+	}
+	defer delete(seen, t)
+	var errs []error
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		key, ok := structFieldKey(f, prefix)
+		if !ok {
+			continue
+		}
+		if isNestedStruct(f.Type) {
+			if key != "" {
+				key += "."
+			}
+			errs = append(errs, b.fieldUnmarshalErrors(f.Type, key, seen)...)
+			continue
+		}
+		if key == "" || !b.cfg.IsSet(key) {
+			continue
+		}
+		v := b.cfg.Get(key)
+		if err := decodeValue(v, reflect.New(f.Type).Interface()); err != nil {
+			if s, ok := v.(string); ok {
+				v = strconv.Quote(s)
+			}
+			errs = append(errs, fmt.Errorf("config key %q: expected %s, got %v", key, f.Type, v))
+		}
+	}
+	return errs
+}
+
+// decodeValue decodes v into out the way viper does when unmarshalling.
+func decodeValue(v, out any) error {
+	d, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Result:           out,
+		WeaklyTypedInput: true,
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+		),
+	})
+	if err != nil {
+		return err
+	}
+	return d.Decode(v)
+}
+
+// ReadInConfigAndUnmarshal reads in the config, as with TryReadInConfig, and
+// unmarshals it into out, as with UnmarshalInto.
+func (b *ViperCfgBuilder) ReadInConfigAndUnmarshal(out any) error {
+	if err := b.readInConfig(); err != nil {
+		return err
+	}
+	_, err := b.UnmarshalInto(out)
+	return err
+}
+
+// applyDefaults sets every known default on viper, in order of precedence so
+// that the winning default is set last.
+func (b *ViperCfgBuilder) applyDefaults() {
+	first, last := b.structDefaults, b.defaults
+	if b.defaultsPrecedence == StructDefaultsWin {
+		first, last = last, first
+	}
+	for k, v := range first {
+		b.cfg.SetDefault(k, v)
+	}
+	for k, v := range last {
+		b.cfg.SetDefault(k, v)
+	}
+}
+
+// defaultValue returns the winning default for key.
+func (b *ViperCfgBuilder) defaultValue(key string) (any, bool) {
+	first, last := b.defaults, b.structDefaults
+	if b.defaultsPrecedence == StructDefaultsWin {
+		first, last = last, first
+	}
+	if v, ok := first[key]; ok {
+		return v, true
+	}
+	v, ok := last[key]
+	return v, ok
+}
+
+// structFieldKey returns the config key of the struct field f when nested
+// under prefix, and false if the field is ignored by viper.
+func structFieldKey(f reflect.StructField, prefix string) (string, bool) {
+	if !f.IsExported() {
+		return "", false
+	}
+	name, opts, _ := strings.Cut(f.Tag.Get("mapstructure"), ",")
+	if name == "-" {
+		return "", false
+	}
+	if strings.Contains(opts, "squash") {
+		return strings.TrimSuffix(prefix, "."), true
+	}
+	if name == "" {
+		name = strings.ToLower(f.Name)
+	}
+	return prefix + name, true
+}
+
+// requiredStructKeys returns the config keys of the required fields of t,
+// prefixed by prefix. Struct types in seen, those t is nested in, are
+// skipped.
+func requiredStructKeys(t reflect.Type, prefix string, seen map[reflect.Type]bool) []string {
+	t, ok := enterStruct(t, seen)
+	if !ok {
+		return nil
+	}
+	defer delete(seen, t)
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		key, ok := structFieldKey(f, prefix)
+		if !ok {
+			continue
+		}
+		if key != "" && isRequiredField(f) {
+			keys = append(keys, key)
+		}
+		if key != "" {
+			key += "."
+		}
+		keys = append(keys, requiredStructKeys(f.Type, key, seen)...)
+	}
+	return keys
+}
+
+// structKeys returns the config keys of the fields of t that aren't structs
+// themselves, prefixed by prefix. Struct types in seen, those t is nested in,
+// are skipped.
+func structKeys(t reflect.Type, prefix string, seen map[reflect.Type]bool) []string {
+	t, ok := enterStruct(t, seen)
+	if !ok {
+		return nil
+	}
+	defer delete(seen, t)
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		key, ok := structFieldKey(f, prefix)
+		if !ok {
+			continue
+		}
+		ft := f.Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if ft.Kind() != reflect.Struct || ft == reflect.TypeOf(time.Time{}) {
+			if key != "" {
+				keys = append(keys, key)
+			}
+			continue
+		}
+		if key != "" {
+			key += "."
+		}
+		keys = append(keys, structKeys(f.Type, key, seen)...)
+	}
+	return keys
+}
+
+func isRequiredField(f reflect.StructField) bool {
+	if f.Tag.Get("required") == "true" {
+		return true
+	}
+	for _, rule := range strings.Split(f.Tag.Get("validate"), ",") {
+		if rule == "required" {
+			return true
+		}
+	}
+	return false
+}
+
+// structDefaults adds the value of every field of v to defaults, keyed by
+// its config key prefixed by prefix. Struct types in seen, those v is nested
+// in, are skipped.
+func structDefaults(v reflect.Value, prefix string, defaults map[string]any, seen map[reflect.Type]bool) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct || seen[v.Type()] {
+		return
+	}
+	seen[v.Type()] = true
+	defer delete(seen, v.Type())
+	for i := 0; i < v.NumField(); i++ {
+		key, ok := structFieldKey(v.Type().Field(i), prefix)
+		if !ok {
+			continue
+		}
+		field := v.Field(i)
+		if isNestedStruct(field.Type()) {
+			if key != "" {
+				key += "."
+			}
+			structDefaults(field, key, defaults, seen)
+			continue
+		}
+		if key != "" {
+			defaults[key] = field.Interface()
+		}
+	}
+}
+
+// enterStruct returns the struct type t is, or points to, and adds it to
+// seen, the struct types being walked, or false if t isn't a struct type or
+// is already being walked, as a type that refers to itself would be.
+func enterStruct(t reflect.Type, seen map[reflect.Type]bool) (reflect.Type, bool) {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct || seen[t] {
+		return t, false
+	}
+	seen[t] = true
+	return t, true
+}
+
+// isNestedStruct returns whether t is a struct, or pointer to one, whose
+// fields map to nested config keys.
+func isNestedStruct(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && t != reflect.TypeOf(time.Time{})
+}
@@ -0,0 +1,128 @@
+package boa
+
+import (
+	"log"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// WithWatch makes the config file be watched for changes, calling onChange
+// after each change has been reloaded, as by Reload, so that long-running
+// programs can pick up config edits without restarting. Watching starts
+// when Build is called, once the config file has been resolved by reading it
+// in. Every config file read is watched, along with the files given to
+// WithMergeConfigFiles, including those that don't exist yet.
+//
+// viper doesn't guard its reads against a reload, so code reading several
+// related keys while the file may change should read them from Snapshot.
+func (b *ViperCfgBuilder) WithWatch(onChange func(fsnotify.Event)) *ViperCfgBuilder {
+	b.onChange = append(b.onChange, onChange)
+	return b
+}
+
+// watch starts watching the config files if WithWatch was used and watching
+// hasn't started already. The files are watched by the builder rather than
+// by viper, whose watcher reads a changed file in itself, outside the
+// reload lock and without processing it.
+func (b *ViperCfgBuilder) watch() {
+	if len(b.onChange) == 0 || b.watching {
+		return
+	}
+	b.reloadMu.RLock()
+	files := b.watchedFiles()
+	b.reloadMu.RUnlock()
+	if len(files) == 0 {
+		log.Printf("Error watching config: no config file to watch")
+		return
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("Error watching config: %v", err)
+		return
+	}
+	// Directories are watched rather than the files themselves, so that
+	// files replaced by renaming another over them, as editors do, and
+	// files created later are still seen.
+	var dirs []string
+	for _, f := range files {
+		if dir := filepath.Dir(f); !contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	for _, dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			log.Printf("Error watching config: %v", err)
+		}
+	}
+	b.watching = true
+	go b.watchFiles(watcher, files)
+}
+
+// watchedFiles returns the config files read and those given to
+// WithMergeConfigFiles.
+func (b *ViperCfgBuilder) watchedFiles() []string {
+	var files []string
+	for _, src := range b.sources {
+		if src.file != "" && !contains(files, filepath.Clean(src.file)) {
+			files = append(files, filepath.Clean(src.file))
+		}
+	}
+	for _, f := range b.mergeFiles {
+		if !contains(files, filepath.Clean(f)) {
+			files = append(files, filepath.Clean(f))
+		}
+	}
+	return files
+}
+
+// watchFiles reloads the config whenever watcher reports that one of files
+// changed, until watcher is closed.
+func (b *ViperCfgBuilder) watchFiles(watcher *fsnotify.Watcher, files []string) {
+	defer watcher.Close()
+	targets := map[string]string{}
+	for _, f := range files {
+		targets[f], _ = filepath.EvalSymlinks(f)
+	}
+	for {
+		select {
+		case e, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if !configChanged(e, files, targets) {
+				continue
+			}
+			if _, err := b.Reload(); err != nil {
+				log.Printf("Error reloading config: %v", err)
+				continue
+			}
+			for _, f := range b.onChange {
+				f(e)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("Error watching config: %v", err)
+		}
+	}
+}
+
+// configChanged returns whether e changed one of files, either by writing or
+// creating it or, as when Kubernetes updates a mounted ConfigMap, by
+// changing the file it links to. targets holds the file each of files links
+// to, and is updated.
+func configChanged(e fsnotify.Event, files []string, targets map[string]string) bool {
+	changed := false
+	for _, f := range files {
+		if filepath.Clean(e.Name) == f && (e.Has(fsnotify.Write) || e.Has(fsnotify.Create)) {
+			changed = true
+		}
+		if target, _ := filepath.EvalSymlinks(f); target != "" && target != targets[f] {
+			targets[f] = target
+			changed = true
+		}
+	}
+	return changed
+}